@@ -15,15 +15,26 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/sigstore/scaffolding/pkg/oidctoken"
 	"sigs.k8s.io/release-utils/version"
 )
 
+var (
+	printToken = flag.Bool("print", false, "Print a token from the ambient OIDC providers to stdout and exit, instead of serving OIDC_FILE.")
+	audience   = flag.String("audience", oidctoken.DefaultAudience, "Audience to request the token for. Only used with -print.")
+	provider   = flag.String("provider", "", "Name of the ambient OIDC provider to use, such as github-actions or spiffe. If unset, the first enabled provider is used. Only used with -print.")
+)
+
 type envConfig struct {
 	FileName string `envconfig:"OIDC_FILE" default:"/var/run/sigstore/cosign/oidc-token" required:"true"`
 }
@@ -47,7 +58,26 @@ func getToken(tokenFile string, w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// writeToken writes a token for audience from the named ambient provider, or
+// the first enabled one if provider is empty, to w.
+func writeToken(ctx context.Context, w io.Writer, provider, audience string) error {
+	tok, err := oidctoken.Get(ctx, provider, audience)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, tok)
+	return err
+}
+
 func main() {
+	flag.Parse()
+	if *printToken {
+		if err := writeToken(context.Background(), os.Stdout, *provider, *audience); err != nil {
+			log.Fatalf("failed to get token: %s", err)
+		}
+		return
+	}
+
 	var env envConfig
 	if err := envconfig.Process("", &env); err != nil {
 		log.Fatalf("failed to process env var: %s", err)
@@ -0,0 +1,92 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sigstore/cosign/pkg/providers"
+	"github.com/sigstore/scaffolding/pkg/oidctoken"
+)
+
+// stubProvider returns a token naming the audience it was asked for.
+type stubProvider struct {
+	enabled bool
+}
+
+func (p stubProvider) Enabled(context.Context) bool { return p.enabled }
+
+func (p stubProvider) Provide(_ context.Context, audience string) (string, error) {
+	return "token-for-" + audience, nil
+}
+
+// The stub providers are registered alongside the real ones, so the tests
+// name them with -provider rather than relying on whichever is enabled.
+func init() {
+	providers.Register("stub-enabled", stubProvider{enabled: true})
+	providers.Register("stub-disabled", stubProvider{})
+}
+
+func TestWriteToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		audience string
+		want     string
+		wantErr  string
+	}{{
+		name:     "default audience",
+		provider: "stub-enabled",
+		audience: oidctoken.DefaultAudience,
+		want:     "token-for-sigstore\n",
+	}, {
+		name:     "custom audience",
+		provider: "stub-enabled",
+		audience: "example.com",
+		want:     "token-for-example.com\n",
+	}, {
+		name:     "disabled provider",
+		provider: "stub-disabled",
+		audience: oidctoken.DefaultAudience,
+		wantErr:  "OIDC provider stub-disabled is not enabled",
+	}, {
+		name:     "unknown provider",
+		provider: "stub-missing",
+		audience: oidctoken.DefaultAudience,
+		wantErr:  "stub-missing is not a valid provider",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := writeToken(context.Background(), &b, tt.provider, tt.audience)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("writeToken() = %v, want error containing %q", err, tt.wantErr)
+				}
+				if b.Len() != 0 {
+					t.Errorf("writeToken() wrote %q on error", b.String())
+				}
+			case err != nil:
+				t.Errorf("writeToken() = %v", err)
+			case b.String() != tt.want:
+				t.Errorf("writeToken() wrote %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bodyVars are the variables a templated request body can use, such as
+// {"nonce":"{{.Nonce}}"}. They are generated afresh for every request.
+type bodyVars struct {
+	// Now is the current time in RFC 3339 format.
+	Now string
+	// UUID is a random version 4 UUID.
+	UUID string
+	// Nonce is 16 random bytes, hex encoded.
+	Nonce string
+}
+
+// isBodyTemplate reports whether body contains template actions. Bodies
+// without them are sent verbatim.
+func isBodyTemplate(body string) bool {
+	return strings.Contains(body, "{{")
+}
+
+// requestBody returns the body to send for a check whose body is body,
+// expanding it as a template if it is one.
+func requestBody(body string) (string, error) {
+	if !isBodyTemplate(body) {
+		return body, nil
+	}
+	tmpl, err := template.New("body").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("parsing body template: %w", err)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	vars := bodyVars{
+		Now:   time.Now().UTC().Format(time.RFC3339),
+		UUID:  uuid.NewString(),
+		Nonce: hex.EncodeToString(nonce),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("expanding body template: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+var (
+	// oidIssuer is the Fulcio extension holding the OIDC issuer as raw
+	// bytes, which older Fulcio versions set.
+	oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidIssuerV2 is the Fulcio extension holding the OIDC issuer as a DER
+	// encoded UTF8String.
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// unknownIssuer labels certificates without an OIDC issuer extension.
+const unknownIssuer = "unknown"
+
+// certIdentities remembers the issuer and identity hash last seen in a
+// certificate from each Fulcio host, to replace the series when they change.
+var certIdentities = struct {
+	sync.Mutex
+	labels map[string]prometheus.Labels
+}{labels: map[string]prometheus.Labels{}}
+
+// recordCertIdentity records the OIDC issuer and a hash of the identity
+// that the leaf certificate in chain, issued by the Fulcio at host, was
+// issued for. The identity is an email address or URI and may be personal,
+// so only its hash is exported. Chains that cannot be parsed are left for
+// verification to report.
+func recordCertIdentity(host string, chain []byte) {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(chain)
+	if err != nil || len(certs) == 0 {
+		return
+	}
+	leaf := certs[0]
+	labels := prometheus.Labels{
+		hostLabel:         host,
+		oidcIssuerLabel:   certIssuer(leaf),
+		identityHashLabel: identityHash(certIdentity(leaf)),
+	}
+
+	certIdentities.Lock()
+	defer certIdentities.Unlock()
+	if prev, ok := certIdentities.labels[host]; ok {
+		if prev[oidcIssuerLabel] == labels[oidcIssuerLabel] && prev[identityHashLabel] == labels[identityHashLabel] {
+			return
+		}
+		logger.Infow("Fulcio certificate identity changed", "host", host,
+			"issuer", labels[oidcIssuerLabel], "identityHash", labels[identityHashLabel])
+		fulcioCertIdentityInfoGauge.Delete(prev)
+	}
+	certIdentities.labels[host] = labels
+	fulcioCertIdentityInfoGauge.With(labels).Set(1)
+}
+
+// certIssuer returns the OIDC issuer Fulcio embedded in cert.
+func certIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidIssuerV2) {
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidIssuer) {
+			return string(ext.Value)
+		}
+	}
+	return unknownIssuer
+}
+
+// certIdentity returns the email address or URI cert was issued for.
+func certIdentity(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+// identityHash returns the first 16 hex digits of the SHA-256 of identity,
+// enough to tell identities apart without exporting them.
+func identityHash(identity string) string {
+	h := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(h[:])[:16]
+}
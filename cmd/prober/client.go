@@ -0,0 +1,221 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	maxIdleConnsPerHost = 10
+	// maxDrainBytes bounds how much of an unread response body is read
+	// before closing it. Larger bodies are not worth reading just to reuse
+	// the connection.
+	maxDrainBytes = 1 << 20
+)
+
+// Values of --http-version.
+const (
+	httpVersionAuto = "auto"
+	httpVersion1    = "1.1"
+	httpVersion2    = "2"
+)
+
+// tlsVersions are the values of --min-tls-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newHTTPClient returns the client shared by all probers, so that
+// connections are pooled and reused across probe cycles.
+func newHTTPClient() (*http.Client, error) {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := newProxy()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		Proxy:           proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	var base http.RoundTripper = transport
+	switch httpVersion {
+	case httpVersionAuto:
+	case httpVersion1:
+		// A non-nil, empty TLSNextProto disables HTTP/2.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case httpVersion2:
+		base = &http2.Transport{TLSClientConfig: tlsConfig}
+	default:
+		return nil, fmt.Errorf("invalid --http-version %q, must be one of %s, %s or %s", httpVersion, httpVersionAuto, httpVersion1, httpVersion2)
+	}
+	return &http.Client{
+		// There is no overall timeout, each probe is bounded by
+		// --request-timeout through its context instead.
+		Transport:     &rateLimitTransport{base: &tracingTransport{base: &userAgentTransport{base: &unixTransport{base: base}}}},
+		CheckRedirect: checkRedirect,
+	}, nil
+}
+
+// newProxy returns the proxy function for the shared client, which sends
+// every request through --proxy-url if it is set and otherwise follows the
+// proxy environment variables.
+func newProxy() (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --proxy-url: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("--proxy-url %q must include a scheme and host", proxyURL)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// userAgentTransport identifies every request the prober makes with
+// --user-agent, so backends can tell probes apart from other traffic.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if userAgent == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// newTLSConfig returns the TLS configuration for the shared client, using
+// the CA bundle from --ca-cert, the client certificate from --client-cert
+// and --client-key and the minimum version from --min-tls-version if they
+// are set.
+func newTLSConfig() (*tls.Config, error) {
+	// Go's default minimum for clients.
+	min := uint16(tls.VersionTLS12)
+	if minTLSVersion != "" {
+		v, ok := tlsVersions[minTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid --min-tls-version %q, must be one of 1.0, 1.1, 1.2 or 1.3", minTLSVersion)
+		}
+		min = v
+	}
+	// Every version is offered and one below the minimum is rejected once
+	// the handshake is done, before any request is sent, so that a server
+	// which does not support the minimum fails with a tlsVersionError. If
+	// crypto/tls enforced the minimum itself, the handshake would fail with
+	// an error it does not export.
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS10,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if cs.Version < min {
+				return &tlsVersionError{version: cs.Version, min: min}
+			}
+			return nil
+		},
+	}
+	if caCert != "" {
+		b, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading --ca-cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in --ca-cert %s", caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	if (clientCert == "") != (clientKey == "") {
+		return nil, fmt.Errorf("--client-cert and --client-key must be set together")
+	}
+	if clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// drainBody reads what is left of body and closes it, so that the
+// connection it came over can be reused for the next probe.
+func drainBody(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
+
+// getJSON fetches url and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	b, err := getBody(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// getBody fetches url and returns the response body.
+func getBody(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusCodeError{statusCode: resp.StatusCode}
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, bodyReadError(err)
+	}
+	return b, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// loadChecks returns the endpoints to probe. When configFile is empty the
+// built-in endpoints are used, otherwise the endpoints are
+// read from the given YAML or JSON file.
+func loadChecks(configFile string) ([]ReadProberCheck, error) {
+	if configFile == "" {
+		return defaultChecks(), nil
+	}
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var checks []ReadProberCheck
+	if err := yaml.UnmarshalStrict(b, &checks); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", configFile, err)
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("config file %s contains no endpoints", configFile)
+	}
+	// Probes are told apart by host and endpoint alone, in the scheduler,
+	// the results and the metrics, so each pair may only appear once.
+	seen := map[string]int{}
+	for i, c := range checks {
+		if err := validateCheck(c); err != nil {
+			return nil, fmt.Errorf("config file %s, endpoint %d: %w", configFile, i, err)
+		}
+		key := c.Host + c.Endpoint
+		if j, ok := seen[key]; ok {
+			return nil, fmt.Errorf("config file %s, endpoint %d: same host and endpoint as endpoint %d, %s%s", configFile, i, j, c.Host, c.Endpoint)
+		}
+		seen[key] = i
+	}
+	return checks, nil
+}
+
+// defaultChecks returns the built-in endpoints for every URL given in
+// --rekor-url, --fulcio-url and --tsa-url, skipping Rekor and Fulcio if
+// they are disabled with --enable-rekor or --enable-fulcio.
+func defaultChecks() []ReadProberCheck {
+	var checks []ReadProberCheck
+	for _, host := range rekorURLs() {
+		for _, r := range RekorEndpoints {
+			r = r.withSearchFixture(rekorSearchHash, rekorSearchUUID)
+			r.Host = host
+			checks = append(checks, r)
+		}
+	}
+	for _, host := range fulcioURLs() {
+		for _, r := range FulcioEndpoints {
+			r.Host = host
+			checks = append(checks, r)
+		}
+	}
+	for _, host := range splitURLs(tsaURL) {
+		for _, r := range TSAEndpoints {
+			r.Host = host
+			checks = append(checks, r)
+		}
+	}
+	return checks
+}
+
+// splitURLs splits a comma-separated list of URLs, such as the value of
+// --rekor-url when probing several shards.
+func splitURLs(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// rekorURLs returns the Rekor URLs to probe, or none if --enable-rekor is
+// false.
+func rekorURLs() []string {
+	if !enableRekor {
+		return nil
+	}
+	return splitURLs(rekorURL)
+}
+
+// fulcioURLs returns the Fulcio URLs to probe, or none if --enable-fulcio
+// is false.
+func fulcioURLs() []string {
+	if !enableFulcio {
+		return nil
+	}
+	return splitURLs(fulcioURL)
+}
+
+// fulcioGRPCURLs returns the Fulcio gRPC addresses to probe, or none if
+// --enable-fulcio is false.
+func fulcioGRPCURLs() []string {
+	if !enableFulcio {
+		return nil
+	}
+	return splitURLs(fulcioGRPCURL)
+}
+
+func validateCheck(c ReadProberCheck) error {
+	switch {
+	case c.Host == "":
+		return fmt.Errorf("missing required field host")
+	case c.Endpoint == "":
+		return fmt.Errorf("missing required field endpoint")
+	case c.Method == "":
+		return fmt.Errorf("missing required field method")
+	}
+	switch c.Method {
+	case GET, POST:
+	default:
+		return fmt.Errorf("unsupported method %q for %s, must be one of %s or %s", c.Method, c.Endpoint, GET, POST)
+	}
+	switch c.AcceptEncoding {
+	case "", encodingGzip, encodingIdentity:
+	default:
+		return fmt.Errorf("unsupported acceptEncoding %q for %s, must be one of %s or %s", c.AcceptEncoding, c.Endpoint, encodingGzip, encodingIdentity)
+	}
+	if c.IntervalSeconds < 0 {
+		return fmt.Errorf("intervalSeconds for %s must not be negative", c.Endpoint)
+	}
+	for _, code := range c.ExpectedStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid expectedStatus %d for %s", code, c.Endpoint)
+		}
+	}
+	if _, err := requestBody(c.Body); err != nil {
+		return fmt.Errorf("body for %s: %w", c.Endpoint, err)
+	}
+	if c.Validate != nil {
+		if err := c.Validate.validate(); err != nil {
+			return fmt.Errorf("%s: %w", c.Endpoint, err)
+		}
+	}
+	return nil
+}
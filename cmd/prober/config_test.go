@@ -0,0 +1,66 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadChecksRejectsDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{{
+		name: "distinct",
+		config: `
+- host: https://rekor.example.com
+  endpoint: /api/v1/log
+  method: GET
+- host: https://rekor2.example.com
+  endpoint: /api/v1/log
+  method: GET
+`,
+	}, {
+		name: "same endpoint, different method",
+		config: `
+- host: https://rekor.example.com
+  endpoint: /api/v1/log/entries/retrieve
+  method: GET
+- host: https://rekor.example.com
+  endpoint: /api/v1/log/entries/retrieve
+  method: POST
+`,
+		wantErr: "endpoint 1: same host and endpoint as endpoint 0",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadChecks(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("loadChecks() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("loadChecks() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
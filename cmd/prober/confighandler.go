@@ -0,0 +1,135 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// configHandler serves the endpoints currently being probed as JSON, with
+// the values of sensitive headers and query parameters redacted. It is only
+// registered with --expose-config.
+func configHandler(live *liveChecks) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		checks := live.get()
+		out := make([]ReadProberCheck, 0, len(checks))
+		for _, c := range checks {
+			out = append(out, redactCheck(c))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			logger.Errorw("writing config", "error", err)
+		}
+	}
+}
+
+// redactCheck returns a copy of c with the values of its sensitive headers,
+// query parameters and body fields replaced, leaving c itself untouched.
+func redactCheck(c ReadProberCheck) ReadProberCheck {
+	c.Body = redactBody(c.Body, c.Headers)
+	c.Headers = redactValues(c.Headers)
+	c.Queries = redactValues(c.Queries)
+	return c
+}
+
+// redactBody returns body with the values of its sensitive fields replaced,
+// at any depth if body is JSON, or if headers say it is a form. Any other
+// body is returned unchanged, as there is no telling what in it is secret.
+func redactBody(body string, headers map[string]string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err == nil {
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		// Keep template actions such as {{.Now}} readable.
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(redactJSON(v)); err == nil {
+			return strings.TrimSuffix(b.String(), "\n")
+		}
+	}
+	for k, ct := range headers {
+		if !strings.EqualFold(k, "Content-Type") || !strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+			continue
+		}
+		form, err := url.ParseQuery(body)
+		if err != nil {
+			break
+		}
+		for k := range form {
+			if isSensitive(k) {
+				form[k] = []string{redacted}
+			}
+		}
+		return form.Encode()
+	}
+	return body
+}
+
+// redactJSON replaces the values of the sensitive fields of the decoded JSON
+// value v and of any objects nested in it.
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if isSensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactJSON(e)
+		}
+	}
+	return v
+}
+
+func redactValues(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if isSensitive(k) {
+			v = redacted
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// isSensitive reports whether a header or query parameter called name is
+// likely to carry a credential.
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	}
+	for _, s := range []string{"token", "secret", "password", "key", "auth"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+const (
+	rekorConsistencyEndpointLabel        = rekorProofEndpoint + " (consistency)"
+	rekorConsistencyLogInfoEndpointLabel = rekorLogInfoEndpoint + " (consistency)"
+)
+
+// verifiedTreeHead is a Rekor tree head that is known to be consistent with
+// every tree head the prober saw before it.
+type verifiedTreeHead struct {
+	size int64
+	root []byte
+}
+
+// treeKey identifies one tree of a Rekor host. Rekor starts a new, empty
+// tree with a new ID when it rotates shards.
+type treeKey struct {
+	host   string
+	treeID string
+}
+
+// verifiedTreeHeads holds the last verified tree head of the current tree of
+// each Rekor host.
+var verifiedTreeHeads = struct {
+	sync.Mutex
+	heads map[treeKey]verifiedTreeHead
+}{heads: map[treeKey]verifiedTreeHead{}}
+
+// rekorConsistencyProbe checks that the current tree of the Rekor log at
+// host is consistent with the tree the prober last verified, by fetching and
+// verifying a consistency proof between the two. The first probe of a host
+// only records its tree head, as there is nothing to check it against yet,
+// and so does the first probe after the tree ID changes, as the new tree is
+// not an extension of the old one.
+func rekorConsistencyProbe(ctx context.Context, client *http.Client, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", rekorConsistencyEndpointLabel)
+
+	var logInfo models.LogInfo
+	admitted, err := admitRequest(withConnTrace(ctx, host))
+	if err != nil {
+		return fmt.Errorf("fetching log info: %w", err)
+	}
+	s := time.Now()
+	err = getJSON(admitted, client, host+rekorLogInfoEndpoint, &logInfo)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, rekorConsistencyLogInfoEndpointLabel, latency, err)
+	if err != nil {
+		return fmt.Errorf("fetching log info: %w", err)
+	}
+	if logInfo.TreeSize == nil || logInfo.RootHash == nil || logInfo.TreeID == nil {
+		return fmt.Errorf("incomplete log info")
+	}
+	root, err := hex.DecodeString(*logInfo.RootHash)
+	if err != nil {
+		return fmt.Errorf("decoding root hash: %w", err)
+	}
+	current := verifiedTreeHead{size: *logInfo.TreeSize, root: root}
+	key := treeKey{host: host, treeID: *logInfo.TreeID}
+
+	verifiedTreeHeads.Lock()
+	prev, ok := verifiedTreeHeads.heads[key]
+	verifiedTreeHeads.Unlock()
+	if !ok {
+		setVerifiedTreeHead(key, current)
+		return nil
+	}
+
+	// Only a proof that was fetched and failed to verify counts against the
+	// log. Failing to fetch it is an ordinary, retryable probe failure.
+	var hashes [][]byte
+	if current.size > prev.size {
+		if hashes, err = consistencyProof(ctx, client, host, prev.size, current.size); err != nil {
+			return err
+		}
+	}
+	err = verifyConsistency(prev, current, hashes)
+	recordConsistencyResult(host, err)
+	if err != nil {
+		return &verificationError{err: err}
+	}
+	setVerifiedTreeHead(key, current)
+	return nil
+}
+
+// consistencyProof fetches the hashes of the proof that the tree of size
+// lastSize of the log at host is consistent with that of size firstSize.
+func consistencyProof(ctx context.Context, client *http.Client, host string, firstSize, lastSize int64) ([][]byte, error) {
+	var cp models.ConsistencyProof
+	url := fmt.Sprintf("%s%s?firstSize=%d&lastSize=%d", host, rekorProofEndpoint, firstSize, lastSize)
+	admitted, err := admitRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching consistency proof from %d to %d: %w", firstSize, lastSize, err)
+	}
+	s := time.Now()
+	err = getJSON(admitted, client, url, &cp)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, rekorConsistencyEndpointLabel, latency, err)
+	if err != nil {
+		return nil, fmt.Errorf("fetching consistency proof from %d to %d: %w", firstSize, lastSize, err)
+	}
+	return decodeHashes(cp.Hashes)
+}
+
+// verifyConsistency checks that the tree head current is an extension of
+// prev, using the consistency proof hashes if the tree has grown.
+func verifyConsistency(prev, current verifiedTreeHead, hashes [][]byte) error {
+	switch {
+	case current.size < prev.size:
+		return fmt.Errorf("tree size shrank from %d to %d", prev.size, current.size)
+	case current.size == prev.size:
+		if !bytes.Equal(prev.root, current.root) {
+			return fmt.Errorf("root hash of tree size %d changed from %x to %x", current.size, prev.root, current.root)
+		}
+		return nil
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, uint64(prev.size), uint64(current.size), hashes, prev.root, current.root); err != nil {
+		return fmt.Errorf("verifying consistency from %d to %d: %w", prev.size, current.size, err)
+	}
+	return nil
+}
+
+// setVerifiedTreeHead records head as the last verified tree head of key,
+// and forgets the other trees of the same host, which it has rotated away
+// from.
+func setVerifiedTreeHead(key treeKey, head verifiedTreeHead) {
+	verifiedTreeHeads.Lock()
+	defer verifiedTreeHeads.Unlock()
+	for k := range verifiedTreeHeads.heads {
+		if k.host == key.host && k.treeID != key.treeID {
+			logger.Infow("Rekor tree ID changed, starting a new consistency baseline", "host", key.host, "previous", k.treeID, "treeID", key.treeID)
+			delete(verifiedTreeHeads.heads, k)
+		}
+	}
+	verifiedTreeHeads.heads[key] = head
+}
+
+func recordConsistencyResult(host string, err error) {
+	rekorConsistencyCounter.With(prometheus.Labels{hostLabel: host, resultLabel: resultOf(err)}).Inc()
+}
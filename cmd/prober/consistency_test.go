@@ -0,0 +1,149 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeRekorLog serves /api/v1/log with the tree ID, size and root hash it
+// is set to, and fails every consistency proof request with proofStatus.
+type fakeRekorLog struct {
+	sync.Mutex
+	treeID      string
+	size        int
+	root        string
+	proofStatus int
+}
+
+func (f *fakeRekorLog) set(size int, root string) {
+	f.Lock()
+	defer f.Unlock()
+	f.size, f.root = size, root
+}
+
+func (f *fakeRekorLog) rotate(treeID string) {
+	f.Lock()
+	defer f.Unlock()
+	f.treeID = treeID
+}
+
+func (f *fakeRekorLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch r.URL.Path {
+	case rekorLogInfoEndpoint:
+		fmt.Fprintf(w, `{"treeSize":%d,"rootHash":%q,"signedTreeHead":"","treeID":%q}`, f.size, f.root, f.treeID)
+	case rekorProofEndpoint:
+		w.WriteHeader(f.proofStatus)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRekorConsistencyProbe(t *testing.T) {
+	client := newTestClient(t)
+	rootA, rootB := strings.Repeat("aa", 32), strings.Repeat("bb", 32)
+
+	t.Run("proof unavailable", func(t *testing.T) {
+		log := &fakeRekorLog{treeID: "1", proofStatus: http.StatusServiceUnavailable}
+		srv := httptest.NewServer(log)
+		defer srv.Close()
+		rekorConsistencyCounter.Reset()
+
+		log.set(1, rootA)
+		if err := rekorConsistencyProbe(context.Background(), client, srv.URL); err != nil {
+			t.Fatalf("first probe = %v, want nil", err)
+		}
+		log.set(2, rootB)
+		err := rekorConsistencyProbe(context.Background(), client, srv.URL)
+		var verifyErr *verificationError
+		if err == nil || errors.As(err, &verifyErr) {
+			t.Fatalf("probe = %v, want an error that is not a verificationError", err)
+		}
+		if !isRetryable(err) {
+			t.Errorf("isRetryable(%v) = false, want true", err)
+		}
+		if n := testutil.CollectAndCount(rekorConsistencyCounter); n != 0 {
+			t.Errorf("prober_rekor_consistency_total has %d series, want 0", n)
+		}
+	})
+
+	t.Run("root changed", func(t *testing.T) {
+		log := &fakeRekorLog{treeID: "1"}
+		srv := httptest.NewServer(log)
+		defer srv.Close()
+		rekorConsistencyCounter.Reset()
+
+		log.set(1, rootA)
+		if err := rekorConsistencyProbe(context.Background(), client, srv.URL); err != nil {
+			t.Fatalf("first probe = %v, want nil", err)
+		}
+		log.set(1, rootB)
+		err := rekorConsistencyProbe(context.Background(), client, srv.URL)
+		var verifyErr *verificationError
+		if !errors.As(err, &verifyErr) {
+			t.Fatalf("probe = %v, want a verificationError", err)
+		}
+		if got := testutil.ToFloat64(rekorConsistencyCounter.WithLabelValues(srv.URL, resultFailure)); got != 1 {
+			t.Errorf("prober_rekor_consistency_total failures = %v, want 1", got)
+		}
+	})
+
+	t.Run("shard rotated", func(t *testing.T) {
+		log := &fakeRekorLog{treeID: "1", proofStatus: http.StatusServiceUnavailable}
+		srv := httptest.NewServer(log)
+		defer srv.Close()
+		rekorConsistencyCounter.Reset()
+
+		log.set(5, rootA)
+		if err := rekorConsistencyProbe(context.Background(), client, srv.URL); err != nil {
+			t.Fatalf("first probe = %v, want nil", err)
+		}
+		// The new shard starts out smaller than the old one.
+		log.rotate("2")
+		log.set(1, rootB)
+		for i := 0; i < 2; i++ {
+			if err := rekorConsistencyProbe(context.Background(), client, srv.URL); err != nil {
+				t.Fatalf("probe %d after rotation = %v, want nil", i, err)
+			}
+		}
+		if n := testutil.CollectAndCount(rekorConsistencyCounter); n != 1 {
+			t.Errorf("prober_rekor_consistency_total has %d series, want 1", n)
+		}
+		if got := testutil.ToFloat64(rekorConsistencyCounter.WithLabelValues(srv.URL, resultSuccess)); got != 1 {
+			t.Errorf("prober_rekor_consistency_total successes = %v, want 1", got)
+		}
+		labels := prometheus.Labels{
+			endpointLabel:   rekorConsistencyLogInfoEndpointLabel,
+			hostLabel:       srv.URL,
+			statusCodeLabel: strconv.Itoa(http.StatusOK),
+		}
+		if got := histogramCount(t, requestDurationHistogram, labels); got != 3 {
+			t.Errorf("prober_request_duration_seconds count for the log info = %d, want 3", got)
+		}
+	})
+}
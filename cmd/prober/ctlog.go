@@ -0,0 +1,122 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+const ctlogSTHEndpoint = ct.GetSTHPath
+
+// ctlogSTHProbe fetches the signed tree head of the CT log at host, which
+// includes the log prefix, and records its tree size and age. If
+// --ctlog-public-key is set the signature on the tree head is verified as
+// well.
+func ctlogSTHProbe(ctx context.Context, client *http.Client, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", ctlogSTHEndpoint)
+
+	req, err := http.NewRequestWithContext(withConnTrace(ctx, host), http.MethodGet, host+ctlogSTHEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(admitted)
+	s := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(s).Milliseconds()
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp.Body)
+
+	logRequest(host, ctlogSTHEndpoint, resp.StatusCode, latency)
+	exportDataToPrometheus(ctx, host, ctlogSTHEndpoint, resp.StatusCode, latency)
+	recordTLSCertExpiry(host, resp.TLS)
+	if resp.StatusCode != http.StatusOK {
+		return &statusCodeError{statusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return bodyReadError(err)
+	}
+	var sthResp ct.GetSTHResponse
+	if err := json.Unmarshal(body, &sthResp); err != nil {
+		return fmt.Errorf("decoding signed tree head: %w", err)
+	}
+	sth, err := sthResp.ToSignedTreeHead()
+	if err != nil {
+		return fmt.Errorf("parsing signed tree head: %w", err)
+	}
+
+	labels := prometheus.Labels{hostLabel: host}
+	ctlogTreeSizeGauge.With(labels).Set(float64(sth.TreeSize))
+	age := time.Since(time.UnixMilli(int64(sth.Timestamp)))
+	ctlogSTHAgeGauge.With(labels).Set(age.Seconds())
+
+	if ctlogPublicKey == "" {
+		return nil
+	}
+	err = verifySTHSignature(sth)
+	recordVerificationResult(host, ctlogSTHEndpoint, err)
+	if err != nil {
+		return &verificationError{err: err}
+	}
+	return nil
+}
+
+// verifySTHSignature verifies the signature on sth against the key in
+// --ctlog-public-key.
+func verifySTHSignature(sth *ct.SignedTreeHead) error {
+	pub, err := ctlogKey()
+	if err != nil {
+		return err
+	}
+	verifier, err := ct.NewSignatureVerifier(pub)
+	if err != nil {
+		return err
+	}
+	if err := verifier.VerifySTHSignature(*sth); err != nil {
+		return fmt.Errorf("verifying signed tree head signature: %w", err)
+	}
+	return nil
+}
+
+// ctlogKey reads the CT log public key from --ctlog-public-key.
+func ctlogKey() (crypto.PublicKey, error) {
+	b, err := os.ReadFile(ctlogPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading --ctlog-public-key: %w", err)
+	}
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --ctlog-public-key: %w", err)
+	}
+	return pub, nil
+}
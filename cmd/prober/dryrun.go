@@ -0,0 +1,61 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// printPlan writes the requests the prober would make for checks, and the
+// other probes it would run, to w without making any of them. Headers,
+// query parameters and body fields that look like credentials are redacted,
+// as on /config.
+func printPlan(w io.Writer, checks []ReadProberCheck) error {
+	for _, r := range checks {
+		r = redactCheck(r)
+		req, err := httpRequest(context.Background(), r.Host, r)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", r.Host, r.Endpoint, err)
+		}
+		if userAgent != "" {
+			// Normally added by the client's transport.
+			req.Header.Set("User-Agent", userAgent)
+		}
+		fmt.Fprintf(w, "%s %s\n", req.Method, req.URL)
+		names := make([]string, 0, len(req.Header))
+		for k := range req.Header {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			v := req.Header.Get(k)
+			if isSensitive(k) {
+				v = redacted
+			}
+			fmt.Fprintf(w, "    %s: %s\n", k, v)
+		}
+		if r.Body != "" {
+			fmt.Fprintf(w, "    body: %s\n", r.Body)
+		}
+	}
+	// Every other probe is made up of several requests, so only list it.
+	for _, j := range probeJobs(checks, nil)[len(checks):] {
+		fmt.Fprintf(w, "PROBE %s %s\n", j.host, j.endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintPlanRedactsCredentials(t *testing.T) {
+	onlyConfiguredChecks(t)
+	defer func(tok string) { authToken = tok }(authToken)
+	authToken = "bearer-secret"
+
+	checks := []ReadProberCheck{{
+		Host:     "https://rekor.example.com",
+		Endpoint: "/api/v1/log",
+		Method:   GET,
+		Headers:  map[string]string{"X-Api-Key": "header-secret", "X-Trace": "visible"},
+		Queries:  map[string]string{"access_token": "query-secret", "logIndex": "10"},
+	}, {
+		Host:     "https://rekor.example.com",
+		Endpoint: "/api/v1/index/retrieve",
+		Method:   POST,
+		Body:     `{"hash":"sha256:abc","auth":{"password":"body-secret"}}`,
+	}, {
+		Host:     "https://oauth.example.com",
+		Endpoint: "/token",
+		Method:   POST,
+		Headers:  map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		Body:     "client_secret=form-secret&grant_type=client_credentials",
+	}}
+	var b bytes.Buffer
+	if err := printPlan(&b, checks); err != nil {
+		t.Fatalf("printPlan() = %v", err)
+	}
+	out := b.String()
+	for _, secret := range []string{"bearer-secret", "header-secret", "query-secret", "body-secret", "form-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printPlan() output contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"logIndex=10", "X-Trace: visible", "X-Api-Key: " + redacted, "Authorization: " + redacted, `"hash":"sha256:abc"`, "grant_type=client_credentials"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printPlan() output does not contain %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+// Legs of the end-to-end prober, used to label prober_e2e_failures_total.
+const (
+	e2eLegFulcio       = "fulcio"
+	e2eLegRekorUpload  = "rekor_upload"
+	e2eLegRekorRead    = "rekor_read"
+	e2eLegVerification = "verification"
+)
+
+const (
+	e2eEndpointLabel    = "fulcio -> rekor (e2e)"
+	e2eSigningCertLabel = fulcioSigningCertEndpoint + " (e2e)"
+	e2eUploadLabel      = rekorEntriesEndpoint + " (e2e)"
+	e2eRetrieveLabel    = rekorEntriesEndpoint + "/{entryUUID} (e2e)"
+)
+
+// e2eLegError is returned by the end-to-end prober when one of its legs
+// fails.
+type e2eLegError struct {
+	leg string
+	err error
+}
+
+func (e *e2eLegError) Error() string {
+	return fmt.Sprintf("%s: %v", e.leg, e.err)
+}
+
+func (e *e2eLegError) Unwrap() error {
+	return e.err
+}
+
+// e2eHost labels the metrics of the end-to-end prober with both the Fulcio
+// and Rekor it runs against.
+func e2eHost(fulcioURL, rekorURL string) string {
+	return fulcioURL + " -> " + rekorURL
+}
+
+// e2eProbe tests that sigstore can be used end to end: it gets a signing
+// certificate from Fulcio, signs some data with it, logs the signature to
+// Rekor and reads the entry back. Each leg is recorded like the write
+// probers, under e2e labels, and the time taken by the whole chain is
+// recorded when it succeeds.
+func e2eProbe(ctx context.Context, client *http.Client, fulcioURL, rekorURL string) error {
+	host := e2eHost(fulcioURL, rekorURL)
+	s := time.Now()
+	err := runE2E(ctx, client, fulcioURL, rekorURL)
+	if err != nil {
+		leg := e2eLegVerification
+		var legErr *e2eLegError
+		if errors.As(err, &legErr) {
+			leg = legErr.leg
+		}
+		e2eFailuresCounter.With(prometheus.Labels{hostLabel: host, legLabel: leg}).Inc()
+		return err
+	}
+	e2eLatencyHistogram.With(prometheus.Labels{hostLabel: host}).Observe(time.Since(s).Seconds())
+	return nil
+}
+
+func runE2E(ctx context.Context, client *http.Client, fulcioURL, rekorURL string) error {
+	chain, priv, err := signingCert(ctx, client, fulcioURL, e2eSigningCertLabel)
+	if err != nil {
+		return &e2eLegError{leg: e2eLegFulcio, err: err}
+	}
+	certs, err := parseCertChain(chain)
+	if err != nil {
+		return &e2eLegError{leg: e2eLegFulcio, err: err}
+	}
+	certPEM, err := cryptoutils.MarshalCertificateToPEM(certs[0])
+	if err != nil {
+		return &e2eLegError{leg: e2eLegFulcio, err: err}
+	}
+
+	b, err := hashedRekordRequest(priv, certPEM)
+	if err != nil {
+		return &e2eLegError{leg: e2eLegRekorUpload, err: err}
+	}
+	uuid, err := uploadEntry(ctx, client, rekorURL, b, e2eUploadLabel)
+	if err != nil {
+		return &e2eLegError{leg: e2eLegRekorUpload, err: err}
+	}
+	body, err := retrieveEntry(ctx, client, rekorURL, uuid, e2eRetrieveLabel)
+	if err != nil {
+		return &e2eLegError{leg: e2eLegRekorRead, err: err}
+	}
+
+	if verifyInclusionProofs {
+		err = verifyInclusion(ctx, client, rekorURL, body)
+		recordVerificationResult(rekorURL, e2eRetrieveLabel, err)
+		if err != nil {
+			return &e2eLegError{leg: e2eLegVerification, err: &verificationError{err: err}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// readBody reads the whole body of resp, decompressing it if it is gzipped,
+// and returns it along with the number of bytes that came over the wire.
+// The wire size is -1 if it is not known, which is the case when Go's
+// transport has already decompressed the body transparently.
+func readBody(resp *http.Response) ([]byte, int, error) {
+	wire := &countingReader{r: resp.Body}
+	var r io.Reader = wire
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), encodingGzip) {
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, 0, fmt.Errorf("decompressing response body: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading response body: %w", bodyReadError(err))
+	}
+	if resp.Uncompressed {
+		return body, -1, nil
+	}
+	return body, wire.n, nil
+}
@@ -14,51 +14,135 @@
 
 package main
 
+import (
+	"fmt"
+	"regexp"
+)
+
 var (
 	GET  = "GET"
 	POST = "POST"
 )
 
 type ReadProberCheck struct {
-	endpoint string
-	method   string
-	body     string
-	queries  map[string]string
+	// Host is the base URL to probe. It may be omitted for the built-in
+	// endpoints, which use --rekor-url and --fulcio-url instead.
+	Host     string `json:"host,omitempty"`
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	// Body is sent as the request body. If it contains template actions
+	// it is expanded for every request, see bodyVars for the variables.
+	Body    string            `json:"body,omitempty"`
+	Queries map[string]string `json:"queries,omitempty"`
+	// Headers are added to the request, and override the default
+	// Content-Type.
+	Headers map[string]string `json:"headers,omitempty"`
+	// AcceptEncoding, if set, is sent as the Accept-Encoding header, either
+	// gzip or identity. The prober then decompresses gzip responses itself,
+	// so that both the wire and decompressed sizes of the body are
+	// measured. If unset, Go's transport asks for gzip and decompresses it
+	// transparently, and only the decompressed size is known.
+	AcceptEncoding string `json:"acceptEncoding,omitempty"`
+	// Priority orders the probes within a cycle, highest first, so that the
+	// most important ones still run if the cycle is cut short. Probes of
+	// the same priority keep their order. The built-in probes, including
+	// the write probers, have priority 0, so use a negative priority for
+	// less critical endpoints.
+	Priority int `json:"priority,omitempty"`
+	// IntervalSeconds is how often to probe the endpoint. If unset, it is
+	// probed every -frequency seconds.
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// ExpectedStatus lists the status codes that count as a successful
+	// probe. If unset, any 2xx status code does.
+	ExpectedStatus []int `json:"expectedStatus,omitempty"`
+	// Validate, if set, describes what the body of a successful response
+	// must look like.
+	Validate *ResponseValidation `json:"validate,omitempty"`
+}
+
+// statusExpected reports whether statusCode counts as a successful probe
+// of r.
+func (r ReadProberCheck) statusExpected(statusCode int) bool {
+	if len(r.ExpectedStatus) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, c := range r.ExpectedStatus {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
 }
 
 var RekorEndpoints = []ReadProberCheck{
 	{
-		endpoint: "/api/v1/version",
-		method:   GET,
+		Endpoint: "/api/v1/version",
+		Method:   GET,
 	}, {
-		endpoint: "/api/v1/log/publicKey",
-		method:   GET,
+		Endpoint: "/api/v1/log/publicKey",
+		Method:   GET,
 	},
 	{
-		endpoint: "/api/v1/log",
-		method:   GET,
+		Endpoint: "/api/v1/log",
+		Method:   GET,
+		Validate: &ResponseValidation{JSONPath: "treeSize"},
 	}, {
-		endpoint: "/api/v1/log/entries",
-		method:   GET,
-		queries:  map[string]string{"logIndex": "10"},
+		Endpoint: "/api/v1/log/entries",
+		Method:   GET,
+		Queries:  map[string]string{"logIndex": "10"},
 	}, {
-		endpoint: "/api/v1/log/proof",
-		method:   GET,
-		queries:  map[string]string{"firstSize": "10", "lastSize": "20"},
+		Endpoint: "/api/v1/log/proof",
+		Method:   GET,
+		Queries:  map[string]string{"firstSize": "10", "lastSize": "20"},
 	}, {
-		endpoint: "/api/v1/log/entries/retrieve",
-		method:   POST,
-		body:     "{\"hash\":\"sha256:2bd37672a9e472c79c64f42b95e362db16870e28a90f3b17fee8faf952e79b4b\"}",
+		Endpoint: rekorEntriesRetrieveEndpoint,
+		Method:   POST,
 	}, {
-		endpoint: "/api/v1/index/retrieve",
-		method:   POST,
-		body:     "{\"hash\":\"sha256:2bd37672a9e472c79c64f42b95e362db16870e28a90f3b17fee8faf952e79b4b\"}",
+		Endpoint: rekorIndexRetrieveEndpoint,
+		Method:   POST,
 	},
 }
 
+// The Rekor endpoints that search the log for --rekor-search-hash.
+const (
+	rekorEntriesRetrieveEndpoint = "/api/v1/log/entries/retrieve"
+	rekorIndexRetrieveEndpoint   = "/api/v1/index/retrieve"
+)
+
+// defaultRekorSearchHash is the hash of an artifact with an entry in the
+// public Rekor log, used as the default --rekor-search-hash.
+const defaultRekorSearchHash = "sha256:2bd37672a9e472c79c64f42b95e362db16870e28a90f3b17fee8faf952e79b4b"
+
+// rekorSearchHashRegexp matches a valid --rekor-search-hash.
+var rekorSearchHashRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// withSearchFixture returns r with its body set to search for hash if r is
+// one of the Rekor search endpoints, and r unchanged otherwise. The
+// response must contain at least one entry and, if uuid is set, mention
+// it, so that an entry missing from the search index fails the probe.
+func (r ReadProberCheck) withSearchFixture(hash, uuid string) ReadProberCheck {
+	if r.Endpoint != rekorEntriesRetrieveEndpoint && r.Endpoint != rekorIndexRetrieveEndpoint {
+		return r
+	}
+	r.Body = fmt.Sprintf(`{"hash":%q}`, hash)
+	r.Validate = &ResponseValidation{JSONPath: "0"}
+	if uuid != "" {
+		r.Validate.Regex = regexp.QuoteMeta(uuid)
+	}
+	return r
+}
+
 var FulcioEndpoints = []ReadProberCheck{
 	{
-		endpoint: "/api/v1/rootCert",
-		method:   GET,
+		Endpoint: "/api/v1/rootCert",
+		Method:   GET,
+		Validate: &ResponseValidation{Regex: "-----BEGIN CERTIFICATE-----"},
+	},
+}
+
+var TSAEndpoints = []ReadProberCheck{
+	{
+		Endpoint: "/api/v1/timestamp/certchain",
+		Method:   GET,
 	},
 }
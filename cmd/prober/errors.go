@@ -0,0 +1,196 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Reasons a probe can fail, used to label prober_request_failures_total.
+const (
+	reasonDNS          = "dns"
+	reasonTLS          = "tls"
+	reasonTLSDowngrade = "tls_downgrade"
+	reasonTimeout      = "timeout"
+	reasonConnection   = "connection"
+	reasonHTTP         = "http"
+	reasonTruncated    = "truncated_response"
+	reasonVerification = "verification"
+	reasonValidation   = "validation"
+	reasonOther        = "other"
+)
+
+// timeoutError is returned by a probe that did not finish within
+// --request-timeout, or that hit one of the transport's shorter timeouts,
+// such as --dial-timeout, in which case timeout is zero.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	if e.timeout == 0 {
+		return fmt.Sprintf("timed out: %v", e.err)
+	}
+	return fmt.Sprintf("timed out after %v: %v", e.timeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// isTimeout reports whether err was caused by a deadline being exceeded.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// truncatedError is returned by a probe whose response headers arrived but
+// whose body could not be read in full, such as when the server closed the
+// connection mid-body.
+type truncatedError struct {
+	err error
+}
+
+func (e *truncatedError) Error() string {
+	return fmt.Sprintf("truncated response: %v", e.err)
+}
+
+func (e *truncatedError) Unwrap() error {
+	return e.err
+}
+
+// bodyReadError wraps err, an error reading a response body, as a
+// truncatedError unless it is a timeout, which is reported as such.
+func bodyReadError(err error) error {
+	if err == nil || isTimeout(err) {
+		return err
+	}
+	return &truncatedError{err: err}
+}
+
+// verificationError is returned by a probe whose request succeeded, but
+// whose response could not be verified.
+type verificationError struct {
+	err error
+}
+
+func (e *verificationError) Error() string {
+	return fmt.Sprintf("verification failed: %v", e.err)
+}
+
+func (e *verificationError) Unwrap() error {
+	return e.err
+}
+
+// validationError is returned by a probe whose response body did not look
+// the way its check says it should.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("validation failed: %v", e.err)
+}
+
+func (e *validationError) Unwrap() error {
+	return e.err
+}
+
+// statusCodeError is returned by a probe that got an unexpected HTTP
+// status code back.
+type statusCodeError struct {
+	statusCode int
+}
+
+func (e *statusCodeError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.statusCode)
+}
+
+// tlsVersionError is returned by a probe whose TLS handshake negotiated a
+// protocol version below the minimum, as happens when the server does not
+// support --min-tls-version.
+type tlsVersionError struct {
+	version, min uint16
+}
+
+func (e *tlsVersionError) Error() string {
+	return fmt.Sprintf("tls: server negotiated TLS %s, below the minimum TLS %s", tlsVersionName(e.version), tlsVersionName(e.min))
+}
+
+// classifyError returns the reason a probe failed with err, so that DNS,
+// TLS, timeout and HTTP failures can be told apart in metrics.
+func classifyError(err error) string {
+	var (
+		dnsErr        *net.DNSError
+		recordErr     tls.RecordHeaderError
+		unknownCAErr  x509.UnknownAuthorityError
+		invalidErr    x509.CertificateInvalidError
+		hostnameErr   x509.HostnameError
+		opErr         *net.OpError
+		statusCodeErr *statusCodeError
+		verifyErr     *verificationError
+		validateErr   *validationError
+		truncatedErr  *truncatedError
+		versionErr    *tlsVersionError
+	)
+	switch {
+	case errors.As(err, &truncatedErr):
+		return reasonTruncated
+	case errors.As(err, &verifyErr):
+		return reasonVerification
+	case errors.As(err, &validateErr):
+		return reasonValidation
+	case errors.As(err, &dnsErr):
+		return reasonDNS
+	case errors.As(err, &versionErr):
+		return reasonTLSDowngrade
+	case errors.As(err, &recordErr), errors.As(err, &unknownCAErr),
+		errors.As(err, &invalidErr), errors.As(err, &hostnameErr):
+		return reasonTLS
+	case isTimeout(err):
+		return reasonTimeout
+	case errors.As(err, &opErr):
+		return reasonConnection
+	case errors.As(err, &statusCodeErr):
+		return reasonHTTP
+	default:
+		return reasonOther
+	}
+}
+
+// isRetryable reports whether a probe that failed with err might succeed if
+// tried again: connection errors, timeouts and 5xx responses are, while
+// verification and validation failures and other status codes are not.
+func isRetryable(err error) bool {
+	var statusCodeErr *statusCodeError
+	if errors.As(err, &statusCodeErr) {
+		return statusCodeErr.statusCode >= 500
+	}
+	switch classifyError(err) {
+	case reasonDNS, reasonTimeout, reasonConnection, reasonTruncated:
+		return true
+	}
+	return false
+}
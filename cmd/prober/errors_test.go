@@ -0,0 +1,110 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	// A *url.Error that is neither a timeout nor a connection error.
+	_, schemeErr := newTestClient(t).Get("ftp://example.com/")
+	if schemeErr == nil {
+		t.Fatal("Get(ftp://...) succeeded, want an error")
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		reason    string
+		retryable bool
+	}{
+		{name: "5xx", err: &statusCodeError{statusCode: 503}, reason: reasonHTTP, retryable: true},
+		{name: "4xx", err: fmt.Errorf("requesting cert: %w", &statusCodeError{statusCode: 404}), reason: reasonHTTP},
+		{name: "unsupported scheme", err: schemeErr, reason: reasonOther},
+		{name: "dns", err: &net.DNSError{Err: "no such host", Name: "example.invalid"}, reason: reasonDNS, retryable: true},
+		{name: "truncated", err: bodyReadError(io.ErrUnexpectedEOF), reason: reasonTruncated, retryable: true},
+		{name: "verification", err: &verificationError{err: errors.New("bad")}, reason: reasonVerification},
+		{name: "other", err: errors.New("something else"), reason: reasonOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.reason {
+				t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.reason)
+			}
+			if got := isRetryable(tt.err); got != tt.retryable {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestTLSDowngrade(t *testing.T) {
+	defer func(ca, min string) { caCert, minTLSVersion = ca, min }(caCert, minTLSVersion)
+	tests := []struct {
+		name          string
+		minTLSVersion string
+		serverMax     uint16
+		wantErr       bool
+	}{
+		{name: "supported minimum", minTLSVersion: "1.2", serverMax: tls.VersionTLS13},
+		{name: "unsupported minimum", minTLSVersion: "1.3", serverMax: tls.VersionTLS12, wantErr: true},
+		{name: "below the default minimum", serverMax: tls.VersionTLS11, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			srv.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tt.serverMax}
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.StartTLS()
+			defer srv.Close()
+			ca := filepath.Join(t.TempDir(), "ca.pem")
+			if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			caCert, minTLSVersion = ca, tt.minTLSVersion
+
+			resp, err := newTestClient(t).Get(srv.URL)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Get() = %v, want nil", err)
+				}
+				resp.Body.Close()
+				return
+			}
+			if err == nil {
+				resp.Body.Close()
+				t.Fatal("Get() succeeded, want a TLS version error")
+			}
+			if got := classifyError(err); got != reasonTLSDowngrade {
+				t.Errorf("classifyError(%v) = %q, want %q", err, got, reasonTLSDowngrade)
+			}
+			if isRetryable(err) {
+				t.Errorf("isRetryable(%v) = true, want false", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix is prepended to the environment variable for each flag.
+const envPrefix = "PROBER_"
+
+// deprecatedFlags maps deprecated flag names to their replacements. They
+// still work, but are left out of the usage message.
+var deprecatedFlags = map[string]string{
+	"frequecy": "frequency",
+	"tuf-root": "trust-root",
+}
+
+// stringList is a flag that may be given more than once, each time with
+// one value or a comma-separated list of them.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, splitURLs(v)...)
+	return nil
+}
+
+// labelMap is a flag of key=value labels that may be given more than once,
+// each time with one label or a comma-separated list of them.
+type labelMap map[string]string
+
+func (m labelMap) String() string {
+	var labels []string
+	for k, v := range m {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+func (m labelMap) Set(v string) error {
+	for _, label := range splitURLs(v) {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("label %q must be of the form key=value", label)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// usage prints the defaults and environment variable for all flags except
+// the deprecated ones.
+func usage() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := deprecatedFlags[f.Name]; !ok {
+			fs.Var(f.Value, f.Name, fmt.Sprintf("%s (env %s)", f.Usage, envVar(f.Name)))
+		}
+	})
+	fmt.Fprintf(fs.Output(), "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(fs.Output(), "Every flag can also be set with the environment variable shown, flags given on the command line take precedence.\n")
+	fs.PrintDefaults()
+}
+
+// envVar returns the environment variable for the flag name, such as
+// PROBER_REKOR_URL for rekor-url.
+func envVar(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlagsFromEnv sets every flag whose environment variable is set to its
+// value. It must be called before flag.Parse so that flags given on the
+// command line override the environment.
+func setFlagsFromEnv() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := deprecatedFlags[f.Name]; ok {
+			return
+		}
+		v, ok := os.LookupEnv(envVar(f.Name))
+		if !ok {
+			return
+		}
+		// Set through the flag set, rather than on f.Value, so that the
+		// flag counts as set and is not overridden by --env.
+		if err := flag.Set(f.Name, v); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "invalid value %q for %s: %v\n", v, envVar(f.Name), err)
+			os.Exit(2)
+		}
+	})
+}
+
+// warnDeprecatedFlags logs a warning for each deprecated flag that was set.
+func warnDeprecatedFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		if replacement, ok := deprecatedFlags[f.Name]; ok {
+			logger.Warnf("flag -%s is deprecated, use -%s instead", f.Name, replacement)
+		}
+	})
+}
+
+// envProfiles are the values of --env, each of which sets the URLs of every
+// service in that Sigstore environment.
+var envProfiles = map[string]map[string]string{
+	"prod": {
+		"rekor-url":  "https://rekor.sigstore.dev",
+		"fulcio-url": "https://fulcio.sigstore.dev",
+		"ctlog-url":  "https://ctfe.sigstore.dev/2022",
+		"tuf-url":    "https://tuf-repo-cdn.sigstore.dev",
+	},
+	"staging": {
+		"rekor-url":  "https://rekor.sigstage.dev",
+		"fulcio-url": "https://fulcio.sigstage.dev",
+		"ctlog-url":  "https://ctfe.sigstage.dev/2022",
+		"tuf-url":    "https://tuf-repo-cdn.sigstage.dev",
+	},
+}
+
+// applyEnvProfile sets every URL flag from the --env profile, except those
+// set explicitly on the command line or from the environment. It must be
+// called after flag.Parse.
+func applyEnvProfile() {
+	if env == "" {
+		return
+	}
+	profile, ok := envProfiles[env]
+	if !ok {
+		names := make([]string, 0, len(envProfiles))
+		for name := range envProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid value %q for -env, must be one of %s\n", env, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, v := range profile {
+		if set[name] {
+			continue
+		}
+		if err := flag.Set(name, v); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "invalid value %q for -%s from -env %s: %v\n", v, name, env, err)
+			os.Exit(2)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const fulcioConfigurationEndpoint = "/api/v2/configuration"
+
+// fulcioConfiguration is the part of Fulcio's GetConfiguration response the
+// prober checks.
+type fulcioConfiguration struct {
+	Issuers []struct {
+		IssuerURL         string `json:"issuerUrl"`
+		WildcardIssuerURL string `json:"wildcardIssuerUrl"`
+	} `json:"issuers"`
+}
+
+// fulcioConfigurationProbe fetches the configuration of the Fulcio instance
+// at host. If --fulcio-expected-issuer is set, the probe fails unless every
+// expected OIDC issuer is advertised, so that an issuer removed by accident
+// is caught while the endpoint still returns 200.
+func fulcioConfigurationProbe(ctx context.Context, client *http.Client, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", fulcioConfigurationEndpoint)
+
+	admitted, err := admitRequest(withConnTrace(ctx, host))
+	if err != nil {
+		return fmt.Errorf("fetching configuration: %w", err)
+	}
+	s := time.Now()
+	b, err := getBody(admitted, client, host+fulcioConfigurationEndpoint)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, fulcioConfigurationEndpoint, latency, err)
+	if err != nil {
+		return fmt.Errorf("fetching configuration: %w", err)
+	}
+
+	if len(fulcioExpectedIssuers) == 0 {
+		return nil
+	}
+	err = checkIssuers(b, fulcioExpectedIssuers)
+	recordVerificationResult(host, fulcioConfigurationEndpoint, err)
+	if err != nil {
+		return &verificationError{err: err}
+	}
+	return nil
+}
+
+// checkIssuers checks that the GetConfiguration response b advertises every
+// issuer in expected, either as an issuer URL or a wildcard issuer URL.
+func checkIssuers(b []byte, expected []string) error {
+	var config fulcioConfiguration
+	if err := json.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("decoding configuration: %w", err)
+	}
+	advertised := map[string]bool{}
+	for _, i := range config.Issuers {
+		for _, u := range []string{i.IssuerURL, i.WildcardIssuerURL} {
+			if u != "" {
+				advertised[u] = true
+			}
+		}
+	}
+	var missing []string
+	for _, u := range expected {
+		if !advertised[u] {
+			missing = append(missing, u)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("configuration is missing issuers %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
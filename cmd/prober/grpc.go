@@ -0,0 +1,97 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	fulciopb "github.com/sigstore/fulcio/pkg/generated/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// fulcioGRPCEndpoint labels the metrics of the Fulcio gRPC prober, so they
+// can be told apart from the REST endpoints.
+const fulcioGRPCEndpoint = "/dev.sigstore.fulcio.v2.CA/GetTrustBundle (grpc)"
+
+// grpcConns holds a connection per probed gRPC host, so that connections
+// are reused across probe cycles like those of the HTTP client.
+var grpcConns = struct {
+	sync.Mutex
+	conns map[string]*grpc.ClientConn
+}{conns: map[string]*grpc.ClientConn{}}
+
+// grpcConn returns the connection to host, dialing it on first use. The
+// connection uses the same CA bundle and client certificate as the HTTP
+// client, unless --fulcio-grpc-insecure is set.
+func grpcConn(ctx context.Context, host string) (*grpc.ClientConn, error) {
+	grpcConns.Lock()
+	defer grpcConns.Unlock()
+	if conn, ok := grpcConns.conns[host]; ok {
+		return conn, nil
+	}
+	creds := insecure.NewCredentials()
+	if !fulcioGRPCInsecure {
+		tlsConfig, err := newTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.DialContext(ctx, host,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent(userAgent))
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", host, err)
+	}
+	grpcConns.conns[host] = conn
+	return conn, nil
+}
+
+// fulcioGRPCProbe calls GetTrustBundle on the Fulcio gRPC API at host and
+// checks that it returns at least one certificate chain.
+func fulcioGRPCProbe(ctx context.Context, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", fulcioGRPCEndpoint)
+
+	conn, err := grpcConn(ctx, host)
+	if err != nil {
+		return err
+	}
+	if err := waitForRequest(ctx); err != nil {
+		return err
+	}
+	s := time.Now()
+	bundle, err := fulciopb.NewCAClient(conn).GetTrustBundle(ctx, &fulciopb.GetTrustBundleRequest{})
+	latency := time.Since(s).Milliseconds()
+
+	// Label the result with the HTTP equivalent of the gRPC status code,
+	// so it reads the same as the REST endpoints.
+	statusCode := runtime.HTTPStatusFromCode(status.Code(err))
+	logRequest(host, fulcioGRPCEndpoint, statusCode, latency)
+	exportDataToPrometheus(ctx, host, fulcioGRPCEndpoint, statusCode, latency)
+	if err != nil {
+		return fmt.Errorf("getting trust bundle: %w", err)
+	}
+	if len(bundle.GetChains()) == 0 {
+		return fmt.Errorf("trust bundle has no certificate chains")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// firstCycleDone is set to 1 once the first full probe cycle completes.
+var firstCycleDone int32
+
+func markFirstCycleDone() {
+	atomic.StoreInt32(&firstCycleDone, 1)
+}
+
+// trustRootLoaded is set to 1 once --trust-root has been loaded.
+var trustRootLoaded int32
+
+func markTrustRootLoaded() {
+	atomic.StoreInt32(&trustRootLoaded, 1)
+}
+
+// healthzHandler reports that the process is up.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyzHandler reports ready only once --trust-root, if set, has been
+// loaded and the first probe cycle has completed, so that the metrics
+// reflect real, verified data.
+func readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	if trustRoot != "" && atomic.LoadInt32(&trustRootLoaded) == 0 {
+		http.Error(w, "trust root has not been loaded", http.StatusServiceUnavailable)
+		return
+	}
+	if atomic.LoadInt32(&firstCycleDone) == 0 {
+		http.Error(w, "first probe cycle has not completed", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// errNoGetBody is why a request whose body cannot be sent twice is not
+// hedged.
+var errNoGetBody = errors.New("request body cannot be copied")
+
+// hedgedResult is the outcome of one of the copies of a hedged request.
+type hedgedResult struct {
+	resp  *http.Response
+	err   error
+	hedge bool
+}
+
+// doHedged sends req with client. If --hedge-after is set and there is no
+// response by then, a second copy of req is sent, and whichever responds
+// first is returned while the other is cancelled. If one copy fails the
+// other is still waited for.
+func doHedged(client *http.Client, req *http.Request, host, endpoint string) (*http.Response, error) {
+	if hedgeAfter <= 0 {
+		return client.Do(req)
+	}
+	results := make(chan hedgedResult, 2)
+	send := func(r *http.Request, hedge bool) context.CancelFunc {
+		ctx, cancel := context.WithCancel(r.Context())
+		r = r.Clone(ctx)
+		go func() {
+			resp, err := client.Do(r)
+			results <- hedgedResult{resp: resp, err: err, hedge: hedge}
+		}()
+		return cancel
+	}
+
+	cancels := map[bool]context.CancelFunc{false: send(req, false)}
+	timer := time.NewTimer(hedgeAfter)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			hedge, err := hedgeRequest(req)
+			if err != nil {
+				logger.Debugw("not hedging request", "host", host, "endpoint", endpoint, "error", err)
+				continue
+			}
+			cancels[true] = send(hedge, true)
+			recordHedge(host, endpoint)
+		case res := <-results:
+			winnerCancel := cancels[res.hedge]
+			delete(cancels, res.hedge)
+			if res.err != nil && len(cancels) > 0 {
+				// The other copy may still succeed.
+				winnerCancel()
+				continue
+			}
+			for _, cancel := range cancels {
+				cancel()
+			}
+			if len(cancels) > 0 {
+				// Clean up after the copy that lost.
+				go func() {
+					if lost := <-results; lost.resp != nil {
+						drainBody(lost.resp.Body)
+					}
+				}()
+				if res.hedge {
+					recordHedgeWin(host, endpoint)
+				}
+			}
+			if res.err != nil {
+				winnerCancel()
+				return nil, res.err
+			}
+			res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: winnerCancel}
+			return res.resp, nil
+		}
+	}
+}
+
+// hedgeRequest returns a copy of req to send as the hedge, with a fresh
+// copy of its body.
+func hedgeRequest(req *http.Request) (*http.Request, error) {
+	hedge := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errNoGetBody
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		hedge.Body = body
+	}
+	return hedge, nil
+}
+
+// cancelOnClose cancels the context of the request a response body belongs
+// to once it has been closed, so that the body can still be read after the
+// response is returned.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
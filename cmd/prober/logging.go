@@ -0,0 +1,91 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
+)
+
+const (
+	logFormatAuto    = "auto"
+	logFormatConsole = "console"
+	logFormatJSON    = "json"
+)
+
+// logger is replaced in main once the flags have been parsed, and
+// requestLogger with it.
+var (
+	logger        = zap.NewNop().Sugar()
+	requestLogger = logger
+)
+
+// setLogger replaces logger with l. requestLogger is derived from it here,
+// rather than on every request, so that logRequest is reported at the
+// caller's line.
+func setLogger(l *zap.SugaredLogger) {
+	logger = l
+	requestLogger = l.Desugar().WithOptions(zap.AddCallerSkip(1)).Sugar()
+}
+
+// newLogger returns a logger at the given level that writes to stderr,
+// leaving stdout to the output of --dry-run and --print-metrics. The "auto"
+// format writes human-readable logs when stderr is a terminal and JSON
+// otherwise.
+func newLogger(level, format string) (*zap.SugaredLogger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	if format == logFormatAuto {
+		format = logFormatJSON
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			format = logFormatConsole
+		}
+	}
+
+	cfg := zap.NewProductionConfig()
+	switch format {
+	case logFormatJSON:
+	case logFormatConsole:
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be one of %s, %s or %s", format, logFormatAuto, logFormatConsole, logFormatJSON)
+	}
+	cfg.Encoding = format
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	// Every probe result matters, so don't sample.
+	cfg.Sampling = nil
+	cfg.OutputPaths = []string{"stderr"}
+
+	l, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	return l.Sugar(), nil
+}
+
+// logRequest logs the outcome of a single request made by a probe.
+func logRequest(host, endpoint string, statusCode int, latency int64) {
+	requestLogger.Infow("observed request",
+		"host", host,
+		"endpoint", endpoint,
+		"status_code", statusCode,
+		"latency_ms", latency)
+}
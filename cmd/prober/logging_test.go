@@ -0,0 +1,65 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogRequestCaller(t *testing.T) {
+	defer setLogger(logger)
+	core, logs := observer.New(zapcore.InfoLevel)
+	setLogger(zap.New(core, zap.AddCaller()).Sugar())
+
+	logRequest("https://rekor.example.com", "/api/v1/log", 200, 12)
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logRequest() logged %d entries, want 1", len(entries))
+	}
+	if file := filepath.Base(entries[0].Caller.File); file != "logging_test.go" {
+		t.Errorf("logRequest() logged from %s, want its caller in logging_test.go", file)
+	}
+}
+
+func TestLoggerWritesToStderr(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stderr *os.File) { os.Stderr = stderr }(os.Stderr)
+	os.Stderr = w
+
+	l, err := newLogger("info", logFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("to stderr")
+	w.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "to stderr") {
+		t.Errorf("newLogger() wrote %q to stderr, want the log entry", b)
+	}
+}
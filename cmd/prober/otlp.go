@@ -0,0 +1,54 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+)
+
+const (
+	// otlpExportTimeout bounds each export of a batch of spans, including
+	// its retries.
+	otlpExportTimeout = 10 * time.Second
+
+	// Backoff between retries of a failed export.
+	otlpRetryInitialInterval = time.Second
+	otlpRetryMaxInterval     = 5 * time.Second
+)
+
+// newOTLPExporter returns an exporter that sends spans to the OTLP collector
+// at endpoint over gRPC, using TLS unless plaintext is set. Exports that
+// fail with a retryable error are retried with backoff until
+// otlpExportTimeout runs out.
+func newOTLPExporter(ctx context.Context, endpoint string, plaintext bool) (*otlptrace.Exporter, error) {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithTimeout(otlpExportTimeout),
+		otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{
+			Enabled:         true,
+			InitialInterval: otlpRetryInitialInterval,
+			MaxInterval:     otlpRetryMaxInterval,
+			MaxElapsedTime:  otlpExportTimeout,
+		}),
+	}
+	if plaintext {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
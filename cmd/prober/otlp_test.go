@@ -0,0 +1,77 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// fakeCollector is an OTLP trace collector that hands the spans it receives
+// to spans.
+type fakeCollector struct {
+	collectorpb.UnimplementedTraceServiceServer
+	spans chan *tracepb.Span
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *collectorpb.ExportTraceServiceRequest) (*collectorpb.ExportTraceServiceResponse, error) {
+	for _, rs := range req.ResourceSpans {
+		for _, ils := range rs.InstrumentationLibrarySpans {
+			for _, s := range ils.Spans {
+				c.spans <- s
+			}
+		}
+	}
+	return &collectorpb.ExportTraceServiceResponse{}, nil
+}
+
+func TestOTLPExporter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &fakeCollector{spans: make(chan *tracepb.Span, 1)}
+	srv := grpc.NewServer()
+	collectorpb.RegisterTraceServiceServer(srv, collector)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx := context.Background()
+	exporter, err := newOTLPExporter(ctx, lis.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("newOTLPExporter() = %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(ctx)
+
+	_, span := tp.Tracer(tracerName).Start(ctx, "/api/v1/log")
+	endSpan(span, nil)
+
+	select {
+	case got := <-collector.spans:
+		if got.Name != "/api/v1/log" {
+			t.Errorf("collector received span %q, want %q", got.Name, "/api/v1/log")
+		}
+	case <-time.After(otlpExportTimeout):
+		t.Fatal("collector received no spans")
+	}
+}
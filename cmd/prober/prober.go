@@ -17,133 +17,1077 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"sigs.k8s.io/release-utils/version"
+)
+
+const (
+	// shutdownTimeout bounds how long in-flight /metrics requests may take
+	// to complete on shutdown.
+	shutdownTimeout = 10 * time.Second
 
-	_ "github.com/sigstore/cosign/pkg/providers/all"
+	// Timeouts for the metrics server, so that slow or stuck clients
+	// cannot tie it up.
+	serverReadHeaderTimeout = 5 * time.Second
+	serverReadTimeout       = 10 * time.Second
+	serverWriteTimeout      = 30 * time.Second
+	serverIdleTimeout       = 2 * time.Minute
 )
 
 var (
-	frequency      int
-	addr           string
-	rekorURL       string
-	fulcioURL      string
-	oneTime        bool
-	runWriteProber bool
+	frequency              int
+	env                    string
+	addr                   string
+	metricsPath            string
+	exposeConfig           bool
+	rekorURL               string
+	fulcioURL              string
+	tsaURL                 string
+	ctlogURL               string
+	fulcioGRPCURL          string
+	fulcioGRPCInsecure     bool
+	enableRekor            bool
+	enableFulcio           bool
+	oneTime                bool
+	cycles                 int
+	deadline               time.Duration
+	reportFile             string
+	printMetrics           bool
+	printVersion           bool
+	dryRun                 bool
+	runWriteProber         bool
+	runE2EProber           bool
+	writeProberInterval    int
+	configFile             string
+	requestTimeout         time.Duration
+	dialTimeout            time.Duration
+	tlsHandshakeTimeout    time.Duration
+	responseHeaderTimeout  time.Duration
+	concurrency            int
+	maxConsecutiveFailures int
+	backoff                bool
+	maxBackoff             time.Duration
+	breakerFailures        int
+	breakerInterval        time.Duration
+	jitter                 float64
+	startDelay             time.Duration
+	sampleFraction         float64
+	retries                int
+	retryDelay             time.Duration
+	hedgeAfter             time.Duration
+	maxRPS                 float64
+	failOnRedirect         bool
+	pushgatewayURL         string
+	pushgatewayJob         string
+	statsdAddr             string
+	otlpEndpoint           string
+	otlpInsecure           bool
+	userAgent              string
+	authToken              string
+	authTokenFile          string
+	basicAuthUser          string
+	basicAuthPass          string
+	logLevel               string
+	logFormat              string
+	latencyBuckets         string
+	legacyLatencyMetrics   bool
+	metricNamespace        string
+	metricSubsystem        string
+	extraLabels            = labelMap{}
+
+	verifyInclusionProofs        bool
+	fulcioRootBundle             string
+	fulcioTrustBundleFingerprint string
+	fulcioExpectedIssuers        stringList
+	identityToken                string
+	identityTokenFile            string
+	signingKeyPath               string
+	tsaCertChainPath             string
+	signingKeyPassword           string
+	ctlogPublicKey               string
+	requireSCT                   bool
+
+	caCert        string
+	clientCert    string
+	clientKey     string
+	minTLSVersion string
+	httpVersion   string
+	proxyURL      string
+
+	tufURL             string
+	tufTargets         stringList
+	trustRoot          string
+	tufExpiryThreshold time.Duration
+	treeSizeSamples    int
+	rekorSearchHash    string
+	rekorSearchUUID    string
 )
 
 func init() {
-	flag.IntVar(&frequency, "frequecy", 10, "How often to run probers (in seconds)")
-	flag.StringVar(&addr, "addr", ":8080", "Port to expose prometheus to")
+	flag.IntVar(&frequency, "frequency", 10, "How often to run probers (in seconds)")
+	flag.IntVar(&frequency, "frequecy", 10, "Deprecated: use -frequency")
+	flag.StringVar(&addr, "addr", ":8080", "Address to expose prometheus to, such as :8080 or 127.0.0.1:8080")
+	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "Path to serve prometheus metrics on.")
+	flag.BoolVar(&exposeConfig, "expose-config", false, "Serve the endpoints currently being probed as JSON on /config, with the values of headers and query parameters that look like credentials redacted.")
+
+	flag.StringVar(&env, "env", "", "Sigstore environment to probe, prod or staging. Sets the default --rekor-url, --fulcio-url, --ctlog-url and --tuf-url together, any of which can still be set to override it.")
+	flag.StringVar(&rekorURL, "rekor-url", "https://rekor.sigstore.dev", "Set to the Rekor URL to run probers against. Multiple URLs may be given separated by commas. Use unix:///path/to.sock to probe over a Unix domain socket.")
+	flag.StringVar(&fulcioURL, "fulcio-url", "https://fulcio.sigstore.dev", "Set to the Fulcio URL to run probers against. Multiple URLs may be given separated by commas. Use unix:///path/to.sock to probe over a Unix domain socket.")
+	flag.StringVar(&tsaURL, "tsa-url", "", "Set to the Timestamp Authority URL to run probers against. Multiple URLs may be given separated by commas. If unset, the Timestamp Authority is not probed.")
+	flag.StringVar(&tsaCertChainPath, "tsa-cert-chain", "", "Path to the PEM certificate chain, leaf first, that timestamps from --tsa-url must be signed with. If unset, the chain each TSA serves at "+tsaCertChainEndpoint+" is used, which checks the signature but not that the TSA is the expected one.")
+	flag.StringVar(&fulcioGRPCURL, "fulcio-grpc-url", "", "Set to the host:port of Fulcio's gRPC API to run probers against. Multiple addresses may be given separated by commas. If unset, the gRPC API is not probed.")
+	flag.BoolVar(&fulcioGRPCInsecure, "fulcio-grpc-insecure", false, "Connect to --fulcio-grpc-url without TLS.")
+	flag.StringVar(&tufURL, "tuf-url", "", "Set to the URL of a TUF repository to check the timestamp, snapshot and targets metadata of. Multiple URLs may be given separated by commas. If unset, TUF metadata is not probed.")
+	flag.Var(&tufTargets, "tuf-target", "Name of a target, such as fulcio_v1.crt.pem, to download from every --tuf-url and check against the length and hashes in its targets metadata. May be given more than once, or as a comma-separated list.")
+	flag.StringVar(&trustRoot, "trust-root", "", "Path to a trusted TUF root.json, loaded at startup before probing begins. If set, the signatures on the timestamp metadata from --tuf-url are verified against it.")
+	flag.StringVar(&trustRoot, "tuf-root", "", "Deprecated: use -trust-root")
+	flag.DurationVar(&tufExpiryThreshold, "tuf-expiry-threshold", 7*24*time.Hour, "Fail the TUF metadata probe when the metadata expires within this long.")
+	flag.IntVar(&treeSizeSamples, "tree-size-samples", 10, "How many recent Rekor tree sizes to keep for each host to derive prober_rekor_entries_rate from. At least 2.")
+	flag.StringVar(&rekorSearchHash, "rekor-search-hash", defaultRekorSearchHash, "Hash, as sha256:<hex>, of an artifact with an existing entry in the Rekor log, to search for with /api/v1/index/retrieve and /api/v1/log/entries/retrieve. The probes fail if the search finds no entries. Set it to an entry seeded in the environment being probed.")
+	flag.StringVar(&rekorSearchUUID, "rekor-search-uuid", "", "UUID of the Rekor entry for --rekor-search-hash. If set, the search probes fail unless the response contains it.")
+	flag.StringVar(&ctlogURL, "ctlog-url", "", "Set to the CT log URL, including the log prefix, to run probers against. Multiple URLs may be given separated by commas. If unset, the CT log is not probed.")
 
-	flag.StringVar(&rekorURL, "rekor-url", "https://rekor.sigstore.dev", "Set to the Rekor URL to run probers against")
-	flag.StringVar(&fulcioURL, "fulcio-url", "https://fulcio.sigstore.dev", "Set to the Fulcio URL to run probers against")
+	flag.BoolVar(&enableRekor, "enable-rekor", true, "Run the Rekor probers. Set to false to skip the built-in Rekor endpoints, the signed tree head prober and the Rekor write prober.")
+	flag.BoolVar(&enableFulcio, "enable-fulcio", true, "Run the Fulcio probers. Set to false to skip the built-in Fulcio endpoints, the gRPC prober and the Fulcio write prober.")
 
+	flag.BoolVar(&printVersion, "version", false, "Print the version of the prober and exit.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the requests the prober would make and exit without making them. Also checks --config and the HTTP client flags, such as --http-version and --ca-cert, for errors.")
 	flag.BoolVar(&oneTime, "one-time", false, "Whether to run only one time and exit.")
+	flag.IntVar(&cycles, "cycles", 0, "Number of probe cycles to run before exiting, non-zero if any probe failed in any of them, such as for a bounded soak test. 0 runs forever, and 1 is the same as -one-time.")
+	flag.DurationVar(&deadline, "deadline", 0, "Bound the whole of a -one-time or --cycles run, including -start-delay, by this long. Probes still running when it elapses are cancelled and count as failed, and the prober exits non-zero. Each request is still bounded by --request-timeout. If unset, there is no deadline.")
+	flag.StringVar(&reportFile, "report-file", "", "Path to write a JSON report of a -one-time run to, with the URL, latency, status code and result of every probe and the overall result. The report is written even if probes fail.")
+	flag.BoolVar(&printMetrics, "print-metrics", false, "Print the gathered metrics to stdout in the Prometheus text format at the end of a -one-time or --cycles run.")
+	flag.StringVar(&pushgatewayURL, "pushgateway-url", "", "URL of a Prometheus Pushgateway to push metrics to after the last cycle completes in -one-time or --cycles mode.")
+	flag.StringVar(&pushgatewayJob, "pushgateway-job", "prober", "Job name to push metrics to the Pushgateway under.")
+	flag.StringVar(&statsdAddr, "statsd-addr", "", "host:port of a StatsD server to also send request latencies and probe results to, with DogStatsD tags. Metric names are prefixed by --metric-namespace and --metric-subsystem. Prometheus metrics are still served.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "host:port of an OTLP gRPC collector to export probe traces to. If unset, tracing is disabled.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Connect to --otlp-endpoint without TLS.")
+	flag.StringVar(&userAgent, "user-agent", "sigstore-scaffolding-prober/"+version.GetVersionInfo().GitVersion, "User-Agent header to send with every probe request.")
+	flag.StringVar(&authToken, "auth-token", "", "Bearer token to send with every read probe, for services behind an authenticating proxy.")
+	flag.StringVar(&authTokenFile, "auth-token-file", "", "Path to a file containing the bearer token to send with every read probe. The file is re-read periodically so rotated tokens are picked up.")
+	flag.StringVar(&basicAuthUser, "basic-auth-user", "", "User name to send with every read probe using HTTP basic auth, for services such as mirrors behind basic auth. Cannot be combined with --auth-token or --auth-token-file.")
+	flag.StringVar(&basicAuthPass, "basic-auth-pass", "", "Password to send with --basic-auth-user.")
 	flag.BoolVar(&runWriteProber, "write-prober", true, " [Kubernetes only] run the probers for the write endpoints.")
+	flag.DurationVar(&requestTimeout, "request-timeout", 30*time.Second, "Timeout for each probe, including the write probers.")
+	flag.DurationVar(&dialTimeout, "dial-timeout", 30*time.Second, "Timeout for connecting to a probed host, so that unreachable hosts fail fast. 0 means only --request-timeout applies. Not used with --http-version 2.")
+	flag.DurationVar(&tlsHandshakeTimeout, "tls-handshake-timeout", 10*time.Second, "Timeout for the TLS handshake with a probed host. 0 means only --request-timeout applies. Not used with --http-version 2.")
+	flag.DurationVar(&responseHeaderTimeout, "response-header-timeout", 0, "Timeout for the response headers after a request has been sent, not including reading the body. If unset, only --request-timeout applies. Not used with --http-version 2.")
+	flag.IntVar(&retries, "retries", 0, "Number of times to retry a probe that fails with a connection error, timeout or 5xx status before recording it as failed. Verification and validation failures are not retried.")
+	flag.DurationVar(&retryDelay, "retry-delay", time.Second, "How long to wait between retries of a failed probe.")
+	flag.DurationVar(&hedgeAfter, "hedge-after", 0, "Send a second copy of a read probe's request if the first has not responded within this long, and use whichever responds first. Measures best-case latency. If unset, requests are not hedged.")
+	flag.Float64Var(&jitter, "jitter", 0, "Randomize the time between probe cycles by up to this fraction of -frequency, such as 0.1 for ±10%.")
+	flag.Float64Var(&sampleFraction, "sample-fraction", 1, "Probe only this fraction of the endpoints on each cycle, such as 0.25 for a quarter of them. Endpoints are taken in turn from a shuffled order, so each is probed at least once every 1/fraction cycles. Useful when many replicas probe the same endpoints.")
+	flag.DurationVar(&startDelay, "start-delay", 0, "How long to wait before the first probe cycle, also in -one-time mode. The delay is randomized by -jitter, so that a fleet of probers rolled out together does not probe in lockstep.")
+	flag.Float64Var(&maxRPS, "max-rps", 0, "Maximum number of requests per second across all probers, including the write probers. Requests over the limit wait rather than being dropped. 0 means no limit.")
+	flag.IntVar(&concurrency, "concurrency", 4, "Number of probes to run in parallel.")
+	flag.IntVar(&maxConsecutiveFailures, "max-consecutive-failures", 0, "Exit with a non-zero status after this many probe cycles in a row in which every probe failed. 0 means never exit.")
+	flag.BoolVar(&backoff, "backoff", true, "Back off probing endpoints that are failing, with jitter, up to --max-backoff. Set to false to probe at a fixed interval.")
+	flag.DurationVar(&maxBackoff, "max-backoff", 5*time.Minute, "Longest time to wait between probes of a failing endpoint when --backoff is set.")
+	flag.IntVar(&breakerFailures, "breaker-failures", 0, "Trip an endpoint's circuit breaker open after this many consecutive failures, so that it is only probed every --breaker-interval until it succeeds again. 0 disables circuit breakers.")
+	flag.DurationVar(&breakerInterval, "breaker-interval", 5*time.Minute, "How often to probe an endpoint whose circuit breaker is open.")
+	flag.StringVar(&metricNamespace, "metric-namespace", "", "Namespace to prefix the names of all exported metrics with, such as sigstore.")
+	flag.StringVar(&metricSubsystem, "metric-subsystem", "", "Subsystem to prefix the names of all exported metrics with, after --metric-namespace.")
+	flag.Var(extraLabels, "extra-label", "Constant label, as key=value, to add to every exported metric, such as region=us-east1 to compare probers running in several places. May be given more than once, or as a comma-separated list.")
+	flag.StringVar(&latencyBuckets, "latency-buckets", "", "Comma-separated list of latency histogram bucket boundaries (in milliseconds). prober_request_duration_seconds uses the same boundaries converted to seconds. If unset, the default buckets are used.")
+	flag.BoolVar(&legacyLatencyMetrics, "legacy-latency-metrics", true, "Deprecated: also export latency in milliseconds as api_endpoint_latency and api_endpoint_latency_histogram, alongside prober_request_duration_seconds. These will be removed once dashboards have moved over.")
+	flag.BoolVar(&verifyInclusionProofs, "verify-inclusion", false, "Verify the inclusion proofs of entries returned by Rekor read endpoints.")
+	flag.StringVar(&fulcioRootBundle, "fulcio-root-bundle", "", "Path to a PEM bundle of Fulcio roots to verify issued certificates against. If unset, the root is fetched from Fulcio.")
+	flag.StringVar(&fulcioTrustBundleFingerprint, "fulcio-trust-bundle-fingerprint", "", "Hex SHA-256 fingerprint that the Fulcio trust bundle must have, as exported in prober_fulcio_trust_bundle_info. Multiple fingerprints may be given separated by commas, such as during a planned rotation. If unset, changes are counted and logged but do not fail the probe.")
+	flag.Var(&fulcioExpectedIssuers, "fulcio-expected-issuer", "URL of an OIDC issuer, such as https://accounts.google.com, that Fulcio must advertise in "+fulcioConfigurationEndpoint+". May be given more than once, or as a comma-separated list. If unset, the configuration is only checked to be available.")
+	flag.StringVar(&ctlogPublicKey, "ctlog-public-key", "", "Path to the PEM public key of the CT log. If set, the signature on the CT log's signed tree head is verified.")
+	flag.BoolVar(&requireSCT, "require-sct", false, "Fail the Fulcio write prober if the issued certificate has no SCT, or if the SCT does not verify against --ctlog-public-key when it is set.")
+	flag.StringVar(&identityToken, "identity-token", "", "OIDC identity token for the Fulcio write prober. If unset, --identity-token-file or the ambient OIDC providers are used.")
+	flag.StringVar(&identityTokenFile, "identity-token-file", "", "Path to a file containing the OIDC identity token for the Fulcio write prober. The file is re-read on every probe so rotated tokens are picked up.")
+	flag.StringVar(&signingKeyPath, "signing-key", "", "Path to an ECDSA private key for the write probers to sign with on every probe, so that the certificates and log entries can be correlated across cycles. May be a cosign key or an unencrypted PEM key. If unset, a new ephemeral key is used for every probe.")
+	flag.StringVar(&signingKeyPassword, "signing-key-password", "", "Password to decrypt --signing-key with, if it is a cosign key.")
+	flag.StringVar(&logLevel, "log-level", "info", "Log level, one of debug, info, warn or error.")
+	flag.StringVar(&logFormat, "log-format", logFormatAuto, "Log format, one of auto, console or json. Logs are written to stderr, and auto uses console when stderr is a terminal and json otherwise.")
+	flag.StringVar(&caCert, "ca-cert", "", "Path to a PEM bundle of CA certificates to trust instead of the system roots.")
+	flag.StringVar(&clientCert, "client-cert", "", "Path to a PEM client certificate to present to probed hosts. Requires --client-key.")
+	flag.StringVar(&clientKey, "client-key", "", "Path to the PEM private key for --client-cert.")
+	flag.StringVar(&minTLSVersion, "min-tls-version", "", "Refuse to send requests over any TLS version below this one, one of 1.0, 1.1, 1.2 or 1.3. Handshakes that negotiate a lower version fail with reason tls_downgrade. If unset, Go's default minimum of 1.2 is used.")
+	flag.StringVar(&httpVersion, "http-version", httpVersionAuto, "HTTP version to probe with, one of auto, 1.1 or 2. auto negotiates HTTP/2 where the host supports it. 2 requires HTTPS and does not use a proxy.")
+	flag.BoolVar(&failOnRedirect, "fail-on-redirect", false, "Fail probes that are redirected instead of following the redirect. Redirects are always counted in prober_redirects_total.")
+	flag.StringVar(&proxyURL, "proxy-url", "", "URL of a forward proxy to send probe requests through, such as http://proxy:3128. If unset, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.")
+	flag.BoolVar(&runE2EProber, "e2e-prober", false, "Run the end-to-end prober, which logs a signature made with a Fulcio certificate to Rekor and reads it back. It runs against the first --fulcio-url and --rekor-url, every --write-prober-interval seconds.")
+	flag.IntVar(&writeProberInterval, "write-prober-interval", 0, "How often to run the write probers (in seconds). If unset, they run every -frequency seconds.")
+	flag.StringVar(&configFile, "config", "", "Path to a YAML or JSON file listing the endpoints to probe. If unset, the built-in Rekor and Fulcio endpoints are used. Send SIGHUP to reload the file without restarting.")
 
-	flag.Parse()
+	flag.Usage = usage
 }
 
 func main() {
-	ctx := context.Background()
+	hup, stopHUP := notifySIGHUP()
+	defer stopHUP()
+	setFlagsFromEnv()
+	flag.Parse()
+	applyEnvProfile()
+
+	versionInfo := version.GetVersionInfo()
+	if printVersion {
+		fmt.Println(versionInfo.String())
+		os.Exit(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l, err := newLogger(logLevel, logFormat)
+	if err != nil {
+		log.Fatalf("creating logger: %v", err)
+	}
+	setLogger(l)
+	defer func() { _ = logger.Sync() }()
+	logger.Infow("running prober", "version", versionInfo.GitVersion, "gitCommit", versionInfo.GitCommit, "buildDate", versionInfo.BuildDate)
+	warnDeprecatedFlags()
+
+	if err := setupTracing(ctx); err != nil {
+		logger.Fatalw("setting up tracing", "error", err)
+	}
+
+	if concurrency < 1 {
+		logger.Fatalf("--concurrency must be at least 1, got %d", concurrency)
+	}
+	if !strings.HasPrefix(metricsPath, "/") {
+		logger.Fatalf("--metrics-path must start with /, got %q", metricsPath)
+	}
+	if maxRPS < 0 {
+		logger.Fatalf("--max-rps must not be negative, got %v", maxRPS)
+	}
+	if requestTimeout <= 0 {
+		logger.Fatalf("--request-timeout must be positive, got %v", requestTimeout)
+	}
+	if dialTimeout < 0 {
+		logger.Fatalf("--dial-timeout must not be negative, got %v", dialTimeout)
+	}
+	if tlsHandshakeTimeout < 0 {
+		logger.Fatalf("--tls-handshake-timeout must not be negative, got %v", tlsHandshakeTimeout)
+	}
+	if responseHeaderTimeout < 0 {
+		logger.Fatalf("--response-header-timeout must not be negative, got %v", responseHeaderTimeout)
+	}
+	if retries < 0 {
+		logger.Fatalf("--retries must not be negative, got %d", retries)
+	}
+	if cycles < 0 {
+		logger.Fatalf("--cycles must not be negative, got %d", cycles)
+	}
+	if oneTime && cycles > 1 {
+		logger.Fatal("-one-time cannot be combined with --cycles")
+	}
+	if oneTime || cycles == 1 {
+		oneTime, cycles = true, 1
+	}
+	if reportFile != "" && !oneTime {
+		logger.Fatal("--report-file requires -one-time")
+	}
+	if printMetrics && cycles == 0 {
+		logger.Fatal("--print-metrics requires -one-time or --cycles")
+	}
+	if deadline < 0 {
+		logger.Fatalf("--deadline must not be negative, got %v", deadline)
+	}
+	if sampleFraction <= 0 || sampleFraction > 1 {
+		logger.Fatalf("--sample-fraction must be greater than 0 and at most 1, got %v", sampleFraction)
+	}
+	if basicAuthUser == "" && basicAuthPass != "" {
+		logger.Fatal("--basic-auth-pass requires --basic-auth-user")
+	}
+	if basicAuthUser != "" && (authToken != "" || authTokenFile != "") {
+		logger.Fatal("--basic-auth-user cannot be combined with --auth-token or --auth-token-file")
+	}
+	if breakerFailures < 0 {
+		logger.Fatalf("--breaker-failures must not be negative, got %d", breakerFailures)
+	}
+	if treeSizeSamples < 2 {
+		logger.Fatalf("--tree-size-samples must be at least 2, got %d", treeSizeSamples)
+	}
+	if !rekorSearchHashRegexp.MatchString(rekorSearchHash) {
+		logger.Fatalf("--rekor-search-hash must be sha256: followed by 64 hex digits, got %q", rekorSearchHash)
+	}
+	if err := validateExtraLabels(extraLabels); err != nil {
+		logger.Fatalf("--extra-label: %v", err)
+	}
+	if jitter < 0 || jitter >= 1 {
+		logger.Fatalf("--jitter must be at least 0 and less than 1, got %v", jitter)
+	}
+	if signingKeyPassword != "" && signingKeyPath == "" {
+		logger.Fatal("--signing-key-password requires --signing-key")
+	}
+	if signingKeyPath != "" {
+		var err error
+		if fixedSigningKey, err = loadSigningKey(signingKeyPath, []byte(signingKeyPassword)); err != nil {
+			logger.Fatalw("loading --signing-key", "error", err)
+		}
+	}
+	if tsaCertChainPath != "" {
+		var err error
+		if tsaCertChain, err = loadTSACertChain(tsaCertChainPath); err != nil {
+			logger.Fatalw("loading --tsa-cert-chain", "error", err)
+		}
+	}
+	checks, err := loadChecks(configFile)
+	if err != nil {
+		logger.Fatalw("loading endpoints", "error", err)
+	}
+	// The client is built before a dry run returns, so that a dry run also
+	// rejects invalid --http-version, TLS and proxy flags.
+	requestLimiter = newRequestLimiter(maxRPS)
+	client, err := newHTTPClient()
+	if err != nil {
+		logger.Fatalw("creating HTTP client", "error", err)
+	}
+	if dryRun {
+		if err := printPlan(os.Stdout, checks); err != nil {
+			logger.Fatalw("printing probe plan", "error", err)
+		}
+		return
+	}
+	logger.Infow("active probers", "probers", activeProbers())
+
+	buckets, err := parseLatencyBuckets(latencyBuckets)
+	if err != nil {
+		logger.Fatalw("parsing --latency-buckets", "error", err)
+	}
+	endpointLatenciesHistogram = newLatencyHistogram(buckets)
+	requestDurationHistogram = newRequestDurationHistogram(buckets)
+	ttfbHistogram = newTTFBHistogram(buckets)
+
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(endpointLatenciesSummary, endpointLatenciesHistogram)
+	// The metrics are created before the flags are parsed, so the
+	// namespace and subsystem are added when registering them instead.
+	// The --extra-label labels are added to every metric, including the Go
+	// and process metrics below.
+	labeled := prometheus.WrapRegistererWith(prometheus.Labels(extraLabels), reg)
+	registerer := prometheus.WrapRegistererWithPrefix(metricPrefix(metricNamespace, metricSubsystem), labeled)
+	if legacyLatencyMetrics {
+		registerer.MustRegister(endpointLatenciesSummary, endpointLatenciesHistogram)
+	}
+	registerer.MustRegister(
+		requestDurationHistogram,
+		ttfbHistogram,
+		probeRequestsCounter,
+		probeFailuresCounter,
+		probeRetriesCounter,
+		hedgedRequestsCounter,
+		hedgeWinsCounter,
+		cycleDurationGauge,
+		rateLimitWaitHistogram,
+		verificationCounter,
+		sctVerificationCounter,
+		validationCounter,
+		endpointUpGauge,
+		lastSuccessGauge,
+		responseBytesHistogram,
+		responseWireBytesHistogram,
+		httpResponsesCounter,
+		redirectsCounter,
+		tlsCertExpiryGauge,
+		tlsConnectionInfoGauge,
+		clockSkewGauge,
+		dnsLatencyHistogram,
+		connectLatencyHistogram,
+		tlsHandshakeLatencyHistogram,
+		ctlogTreeSizeGauge,
+		ctlogSTHAgeGauge,
+		rekorTreeSizeGauge,
+		rekorSTHAgeGauge,
+		rekorEntriesRateGauge,
+		rekorTreeSizeDecreasesCounter,
+		rekorSTHSignatureFailuresCounter,
+		rekorConsistencyCounter,
+		fulcioTrustBundleChangedCounter,
+		fulcioTrustBundleInfoGauge,
+		fulcioCertIdentityInfoGauge,
+		tufExpiryGauge,
+		tufTargetVerificationCounter,
+		tokenRefreshCounter,
+		configReloadCounter,
+		requestBuildErrorsCounter,
+		breakerStateGauge,
+		configInfoGauge,
+		configLoadTimeGauge,
+		e2eLatencyHistogram,
+		e2eFailuresCounter,
+		buildInfoGauge,
+	)
+	// The standard Go runtime and process metrics, such as go_goroutines and
+	// process_open_fds, keep their usual names without the namespace so that
+	// the usual dashboards work.
+	labeled.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
-	go runProbers(ctx, frequency, oneTime)
+	if statsdAddr != "" {
+		sink, err := newStatsdSink(statsdAddr, statsdPrefix(metricNamespace, metricSubsystem))
+		if err != nil {
+			logger.Fatalw("creating StatsD sink", "error", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	var report *reportSink
+	if reportFile != "" {
+		report = newReportSink()
+		sinks = append(sinks, report)
+	}
 
 	// Expose the registered metrics via HTTP.
-	http.Handle("/metrics", promhttp.HandlerFor(
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(
 		reg,
 		promhttp.HandlerOpts{
 			// Opt into OpenMetrics to support exemplars.
 			EnableOpenMetrics: true,
 		},
 	))
-	log.Fatal(http.ListenAndServe(addr, nil))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	live := newLiveChecks(checks)
+	if exposeConfig {
+		mux.HandleFunc("/config", configHandler(live))
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalw("serving metrics", "error", err)
+		}
+	}()
+
+	var pusher *push.Pusher
+	if pushgatewayURL != "" {
+		if pusher, err = newPusher(reg); err != nil {
+			logger.Fatalw("creating pushgateway client", "error", err)
+		}
+	}
+
+	// Load the trust material before probing, so that verification never
+	// silently runs without it. /readyz reports not ready until this is done.
+	if trustRoot != "" {
+		if trustedRoot, err = loadTrustRoot(trustRoot); err != nil {
+			logger.Fatalw("loading --trust-root", "error", err)
+		}
+		markTrustRootLoaded()
+		logger.Infow("loaded trust root", "version", trustedRoot.Version, "expires", trustedRoot.Expires)
+	} else if tufURL != "" {
+		logger.Warn("--tuf-url is set without --trust-root, TUF metadata signatures will not be verified")
+	}
+
+	recordConfigInfo(checks)
+	go reloadOnSIGHUP(ctx, hup, live)
+	summary := runProbers(ctx, frequency, cycles, live, client, pusher)
+	if report != nil {
+		if err := report.write(reportFile, probeJobs(live.get(), client), summary); err != nil {
+			logger.Errorw("writing --report-file", "error", err)
+		}
+	}
+	if printMetrics {
+		if err := writeMetrics(os.Stdout, reg); err != nil {
+			logger.Errorw("printing metrics", "error", err)
+		}
+	}
+
+	// Let in-flight scrapes of /metrics complete before exiting.
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Errorw("shutting down metrics server", "error", err)
+	}
+	shutdownTracing(shutdownCtx)
+	cancel()
+	if summary.err != nil {
+		logger.Errorw("exiting with failure", "error", summary.err)
+		os.Exit(1)
+	}
+}
+
+// newPusher returns a client that pushes the metrics in reg to
+// --pushgateway-url, grouped by the host the prober runs on so that
+// concurrent runs do not overwrite each other.
+func newPusher(reg *prometheus.Registry) (*push.Pusher, error) {
+	instance, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("getting hostname: %w", err)
+	}
+	return push.New(pushgatewayURL, pushgatewayJob).
+		Gatherer(reg).
+		Grouping("instance", instance), nil
+}
+
+// errProbesFailed is returned by runProbers in -one-time or --cycles mode
+// when any probe failed in any cycle.
+var errProbesFailed = errors.New("one or more probes failed")
+
+// errDeadlineExceeded is returned by runProbers in -one-time or --cycles mode
+// when --deadline elapses before every probe has finished.
+var errDeadlineExceeded = errors.New("--deadline elapsed before every probe finished")
+
+// probeSummary is what runProbers returns when it stops.
+type probeSummary struct {
+	// results holds the result of each probe in the last completed
+	// cycle, keyed by job key.
+	results map[string]error
+	// err is why the prober should exit with a failure, or nil.
+	err error
 }
 
-func runProbers(ctx context.Context, freq int, runOnce bool) {
-	for {
-		hasErr := false
+// runProbers runs probe cycles every freq seconds until ctx is done, or
+// only n cycles if n is not zero. The summary it returns has an error if the
+// prober should exit with a failure: when running n cycles, if any probe
+// failed in any of them or the metrics could not be pushed, and otherwise
+// when --max-consecutive-failures is reached.
+func runProbers(ctx context.Context, freq, n int, checks *liveChecks, client *http.Client, pusher *push.Pusher) probeSummary {
+	var maxWait time.Duration
+	if backoff {
+		maxWait = maxBackoff
+	}
+	sched := newScheduler(time.Duration(freq)*time.Second, maxWait, breakerFailures, breakerInterval)
+
+	// probeCtx is ctx bounded by --deadline when running n cycles. ctx
+	// being done means the prober is shutting down, while probeCtx alone
+	// being done means the deadline has elapsed.
+	probeCtx := ctx
+	if n > 0 && deadline > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
 
-		for _, r := range RekorEndpoints {
-			if err := observeRequest(rekorURL, r); err != nil {
-				hasErr = true
-				fmt.Printf("error running request %s: %v\n", r.endpoint, err)
+	if startDelay > 0 {
+		delay := sched.jitter(startDelay, jitter)
+		logger.Infow("delaying first probe cycle", "delay", delay.String())
+		select {
+		case <-probeCtx.Done():
+			if ctx.Err() != nil {
+				return probeSummary{}
 			}
+			return probeSummary{err: errDeadlineExceeded}
+		case <-time.After(delay):
 		}
-		for _, r := range FulcioEndpoints {
-			if err := observeRequest(fulcioURL, r); err != nil {
-				hasErr = true
-				fmt.Printf("error running request %s: %v\n", r.endpoint, err)
+	}
+	var summary probeSummary
+	failedCycles := 0
+	anyCycleFailed := false
+	// finish ends a run of n cycles, once they are done or the deadline has
+	// elapsed.
+	finish := func() probeSummary {
+		if pusher != nil {
+			if err := pusher.Push(); err != nil {
+				summary.err = fmt.Errorf("pushing metrics to pushgateway: %w", err)
+				return summary
 			}
 		}
-		if runWriteProber {
-			if err := fulcioWriteEndpoint(ctx); err != nil {
-				hasErr = true
-				fmt.Printf("error running fulcio write prober: %v\n", err)
-			}
+		switch {
+		case probeCtx.Err() != nil:
+			summary.err = errDeadlineExceeded
+		case anyCycleFailed:
+			summary.err = errProbesFailed
+		}
+		return summary
+	}
+	for cycle := 1; ; cycle++ {
+		start := time.Now()
+		jobs := byPriority(sched.due(sched.sample(probeJobs(checks.get(), client), sampleFraction), start))
+		results := runCycle(probeCtx, jobs, concurrency)
+		if ctx.Err() != nil {
+			return summary
 		}
-		fmt.Println("Complete")
+		if probeCtx.Err() != nil {
+			failUnstarted(jobs, results)
+		}
+		sched.record(jobs, results)
+		summary.results = results
+		elapsed := time.Since(start)
+		cycleDurationGauge.Set(elapsed.Seconds())
+		logger.Infow("completed probe cycle", "duration", elapsed.String())
+		if elapsed > time.Duration(freq)*time.Second {
+			logger.Warnw("probe cycle took longer than -frequency, consider raising -concurrency or -frequency", "duration", elapsed.String(), "frequency", freq)
+		}
+		markFirstCycleDone()
 
-		if runOnce {
-			if hasErr {
-				os.Exit(1)
+		if maxConsecutiveFailures > 0 && len(results) > 0 {
+			if allFailed(results) {
+				failedCycles++
 			} else {
-				os.Exit(0)
+				failedCycles = 0
+			}
+			if failedCycles >= maxConsecutiveFailures {
+				summary.err = fmt.Errorf("every probe failed in %d consecutive cycles", failedCycles)
+				return summary
+			}
+		}
+
+		if anyFailed(results) {
+			anyCycleFailed = true
+		}
+		if cycle == n || (n > 0 && probeCtx.Err() != nil) {
+			return finish()
+		}
+
+		select {
+		case <-probeCtx.Done():
+			if ctx.Err() != nil {
+				return summary
 			}
+			return finish()
+		case <-time.After(sched.jitter(time.Duration(freq)*time.Second, jitter)):
 		}
+	}
+}
+
+// probeJob is a single probe run as part of a cycle.
+type probeJob struct {
+	host     string
+	endpoint string
+	// interval is how often the probe runs. If zero, it runs on every
+	// cycle.
+	interval time.Duration
+	// priority orders the probe within a cycle, highest first.
+	priority int
+	run      func(context.Context) error
+}
 
-		time.Sleep(time.Duration(frequency) * time.Second)
+// key identifies the probe across cycles.
+func (j probeJob) key() string {
+	return j.host + j.endpoint
+}
+
+// probeJobs returns the probes to run in one cycle: every read endpoint,
+// Rekor signed tree head, CT log and Fulcio gRPC API, followed by the write
+// and end-to-end probers if they are enabled.
+func probeJobs(checks []ReadProberCheck, client *http.Client) []probeJob {
+	jobs := make([]probeJob, 0, len(checks))
+	readsTrustBundle := map[string]bool{}
+	for _, r := range checks {
+		r := r
+		if returnsTrustBundle(r) {
+			readsTrustBundle[r.Host] = true
+		}
+		jobs = append(jobs, probeJob{
+			host:     r.Host,
+			endpoint: r.Endpoint,
+			interval: time.Duration(r.IntervalSeconds) * time.Second,
+			priority: r.Priority,
+			run: func(ctx context.Context) error {
+				return observeRequest(ctx, client, r.Host, r)
+			},
+		})
 	}
+	for _, host := range rekorURLs() {
+		host := host
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: rekorSTHEndpointLabel,
+			run: func(ctx context.Context) error {
+				return rekorSTHProbe(ctx, client, host)
+			},
+		})
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: rekorConsistencyEndpointLabel,
+			run: func(ctx context.Context) error {
+				return rekorConsistencyProbe(ctx, client, host)
+			},
+		})
+	}
+	for _, host := range splitURLs(ctlogURL) {
+		host := host
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: ctlogSTHEndpoint,
+			run: func(ctx context.Context) error {
+				return ctlogSTHProbe(ctx, client, host)
+			},
+		})
+	}
+	for _, host := range fulcioURLs() {
+		if readsTrustBundle[host] {
+			// The read probe of the trust bundle already checks it.
+			continue
+		}
+		host := host
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: fulcioTrustBundleEndpointLabel,
+			run: func(ctx context.Context) error {
+				return fulcioTrustBundleProbe(ctx, client, host)
+			},
+		})
+	}
+	for _, host := range fulcioURLs() {
+		host := host
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: fulcioConfigurationEndpoint,
+			run: func(ctx context.Context) error {
+				return fulcioConfigurationProbe(ctx, client, host)
+			},
+		})
+	}
+	for _, host := range fulcioGRPCURLs() {
+		host := host
+		jobs = append(jobs, probeJob{
+			host:     host,
+			endpoint: fulcioGRPCEndpoint,
+			run: func(ctx context.Context) error {
+				return fulcioGRPCProbe(ctx, host)
+			},
+		})
+	}
+	for _, host := range splitURLs(tufURL) {
+		for _, role := range tufRoles {
+			host, role := host, role
+			jobs = append(jobs, probeJob{
+				host:     host,
+				endpoint: tufMetadataEndpoint(role),
+				run: func(ctx context.Context) error {
+					return tufMetadataProbe(ctx, client, host, role)
+				},
+			})
+		}
+		for _, target := range tufTargets {
+			host, target := host, target
+			jobs = append(jobs, probeJob{
+				host:     host,
+				endpoint: tufTargetEndpoint(target),
+				run: func(ctx context.Context) error {
+					return tufTargetProbe(ctx, client, host, target)
+				},
+			})
+		}
+	}
+	if runWriteProber {
+		for _, host := range fulcioURLs() {
+			host := host
+			jobs = append(jobs, probeJob{
+				host:     host,
+				endpoint: fulcioSigningCertEndpoint,
+				interval: time.Duration(writeProberInterval) * time.Second,
+				run: func(ctx context.Context) error {
+					return fulcioWriteEndpoint(ctx, client, host)
+				},
+			})
+		}
+		for _, host := range rekorURLs() {
+			host := host
+			jobs = append(jobs, probeJob{
+				host:     host,
+				endpoint: rekorWriteEndpointLabel,
+				interval: time.Duration(writeProberInterval) * time.Second,
+				run: func(ctx context.Context) error {
+					return rekorWriteEndpoint(ctx, client, host)
+				},
+			})
+		}
+		for _, host := range splitURLs(tsaURL) {
+			host := host
+			jobs = append(jobs, probeJob{
+				host:     host,
+				endpoint: tsaTimestampEndpoint,
+				interval: time.Duration(writeProberInterval) * time.Second,
+				run: func(ctx context.Context) error {
+					return tsaWriteEndpoint(ctx, client, host)
+				},
+			})
+		}
+	}
+	if fulcios, rekors := fulcioURLs(), rekorURLs(); runE2EProber && len(fulcios) > 0 && len(rekors) > 0 {
+		jobs = append(jobs, probeJob{
+			host:     e2eHost(fulcios[0], rekors[0]),
+			endpoint: e2eEndpointLabel,
+			interval: time.Duration(writeProberInterval) * time.Second,
+			run: func(ctx context.Context) error {
+				return e2eProbe(ctx, client, fulcios[0], rekors[0])
+			},
+		})
+	}
+	return jobs
 }
 
-func observeRequest(host string, r ReadProberCheck) error {
-	fmt.Println("Observing ", host+r.endpoint)
-	client := &http.Client{}
+// activeProbers returns the names of the probers that will run, for logging
+// at startup.
+func activeProbers() []string {
+	var active []string
+	if configFile != "" {
+		active = append(active, "config")
+	}
+	if len(rekorURLs()) > 0 {
+		active = append(active, "rekor")
+	}
+	if len(fulcioURLs()) > 0 {
+		active = append(active, "fulcio")
+	}
+	if len(fulcioGRPCURLs()) > 0 {
+		active = append(active, "fulcio-grpc")
+	}
+	if len(splitURLs(tsaURL)) > 0 {
+		active = append(active, "tsa")
+	}
+	if len(splitURLs(ctlogURL)) > 0 {
+		active = append(active, "ctlog")
+	}
+	if len(splitURLs(tufURL)) > 0 {
+		active = append(active, "tuf")
+	}
+	if runWriteProber {
+		active = append(active, "write")
+	}
+	if runE2EProber && len(fulcioURLs()) > 0 && len(rekorURLs()) > 0 {
+		active = append(active, "e2e")
+	}
+	return active
+}
+
+// failUnstarted fails every job that --deadline elapsed before it could
+// start, adding it to results.
+func failUnstarted(jobs []probeJob, results map[string]error) {
+	for _, j := range jobs {
+		if _, ok := results[j.key()]; ok {
+			continue
+		}
+		err := &timeoutError{timeout: deadline, err: context.DeadlineExceeded}
+		recordProbeResult(j.host, j.endpoint, err)
+		results[j.key()] = err
+		logger.Errorw("probe failed", "host", j.host, "endpoint", j.endpoint, "error", err)
+	}
+}
+
+// runCycle runs the given probes across a pool of workers and returns the
+// result of each probe that ran, keyed by job key.
+func runCycle(ctx context.Context, jobs []probeJob, workers int) map[string]error {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]error, len(jobs))
+	)
+	work := make(chan probeJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				err := runProbe(ctx, j.host, j.endpoint, j.run)
+				mu.Lock()
+				results[j.key()] = err
+				mu.Unlock()
+				if err != nil {
+					logger.Errorw("probe failed", "host", j.host, "endpoint", j.endpoint, "error", err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, j := range jobs {
+		select {
+		case <-ctx.Done():
+			break feed
+		case work <- j:
+		}
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// allFailed reports whether every result of a cycle is an error.
+func allFailed(results map[string]error) bool {
+	for _, err := range results {
+		if err == nil {
+			return false
+		}
+	}
+	return true
+}
 
-	req, err := httpRequest(host, r)
+// anyFailed reports whether any of the results of a cycle is an error.
+func anyFailed(results map[string]error) bool {
+	for _, err := range results {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// runProbe runs a single probe bounded by --request-timeout and records its
+// result. A probe that runs out of time, or is cut short by --deadline, is
+// reported as a timeout. Probes that fail with a transient error are retried
+// up to --retries times, and only the final attempt is recorded.
+func runProbe(ctx context.Context, host, endpoint string, probe func(context.Context) error) error {
+	spanCtx, span := startProbeSpan(withProbeTarget(ctx, host, endpoint), host, endpoint)
+
+	err := probeWithRetries(ctx, spanCtx, host, endpoint, probe)
+	if ctx.Err() != nil {
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// The prober is shutting down, so this probe was interrupted
+			// rather than failed.
+			endSpan(span, err)
+			return err
+		}
+		if err != nil {
+			err = &timeoutError{timeout: deadline, err: err}
+		}
+	}
+	endSpan(span, err)
+	recordProbeResult(host, endpoint, err)
+	return err
+}
+
+// probeWithRetries runs probe in spanCtx, retrying it while it fails with a
+// transient error, and returns the error of the last attempt. It stops early
+// once ctx is done.
+func probeWithRetries(ctx, spanCtx context.Context, host, endpoint string, probe func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := probeOnce(spanCtx, probe)
+		if err == nil || ctx.Err() != nil || attempt >= retries || !isRetryable(err) {
+			return err
+		}
+		logger.Infow("retrying probe", "host", host, "endpoint", endpoint, "attempt", attempt+1, "error", err)
+		recordProbeRetry(host, endpoint)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// probeOnce makes a single attempt at probe within --request-timeout.
+func probeOnce(ctx context.Context, probe func(context.Context) error) error {
+	probeCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	err := probe(probeCtx)
+	if err != nil && ctx.Err() == nil && isTimeout(err) {
+		timeout := requestTimeout
+		if probeCtx.Err() == nil {
+			// One of the transport's own timeouts fired first.
+			timeout = 0
+		}
+		err = &timeoutError{timeout: timeout, err: err}
+	}
+	return err
+}
+
+func observeRequest(ctx context.Context, client *http.Client, host string, r ReadProberCheck) error {
+	logger.Debugw("observing", "host", host, "endpoint", r.Endpoint)
+
+	req, err := httpRequest(withConnTrace(ctx, host), host, r)
 	if err != nil {
-		return err
+		recordRequestBuildError(r.Endpoint)
+		return fmt.Errorf("building request: %w", err)
 	}
 
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return err
+	}
 	s := time.Now()
-	resp, err := client.Do(req)
+	req = req.WithContext(withFirstByteTrace(admitted, host, r.Endpoint, s))
+	resp, err := doHedged(client, req, host, r.Endpoint)
 	latency := time.Since(s).Milliseconds()
 
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer drainBody(resp.Body)
 
-	labels := prometheus.Labels{
-		endpointLabel:   r.endpoint,
-		statusCodeLabel: fmt.Sprintf("%d", resp.StatusCode),
-		hostLabel:       host,
+	logRequest(host, r.Endpoint, resp.StatusCode, latency)
+	exportDataToPrometheus(ctx, host, r.Endpoint, resp.StatusCode, latency)
+	recordTLSCertExpiry(host, resp.TLS)
+	recordTLSConnection(host, resp.TLS)
+	recordHTTPProtocol(host, resp.Proto)
+	recordClockSkew(host, resp.Header, time.Now())
+
+	// Read the whole body, both to measure it and so that the connection
+	// can be reused. Latency is measured to the response headers, so it
+	// never includes reading or decompressing the body.
+	body, wireBytes, err := readBody(resp)
+	if err != nil {
+		return err
+	}
+	recordResponseSize(host, r.Endpoint, len(body), wireBytes)
+	if !r.statusExpected(resp.StatusCode) {
+		return &statusCodeError{statusCode: resp.StatusCode}
+	}
+	if r.Validate != nil {
+		err := r.Validate.check(body)
+		recordValidationResult(host, r.Endpoint, err)
+		if err != nil {
+			return &validationError{err: err}
+		}
+	}
+	if returnsTrustBundle(r) && resp.StatusCode == http.StatusOK {
+		if err := checkTrustBundle(host, body); err != nil {
+			return err
+		}
+	}
+	if returnsTSACertChain(r) && resp.StatusCode == http.StatusOK {
+		if err := recordServedCertChain(host, body); err != nil {
+			return err
+		}
+	}
+
+	if verifyInclusionProofs && returnsLogEntry(r) && resp.StatusCode == http.StatusOK {
+		err = verifyInclusion(ctx, client, host, body)
+		recordVerificationResult(host, r.Endpoint, err)
+		if err != nil {
+			return &verificationError{err: err}
+		}
 	}
-	fmt.Println("Status code: ", resp.StatusCode)
-	fmt.Println("Latency: ", latency)
-	endpointLatenciesHistogram.With(labels).Observe(float64(latency))
-	endpointLatenciesSummary.With(labels).Observe(float64(latency))
 	return nil
 }
 
-func httpRequest(host string, r ReadProberCheck) (*http.Request, error) {
-	req, err := http.NewRequest(r.method, host+r.endpoint, bytes.NewBuffer([]byte(r.body)))
+func httpRequest(ctx context.Context, host string, r ReadProberCheck) (*http.Request, error) {
+	body, err := requestBody(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, host+r.Endpoint, bytes.NewBuffer([]byte(body)))
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	tok, err := probeAuthToken()
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	if basicAuthUser != "" {
+		req.SetBasicAuth(basicAuthUser, basicAuthPass)
+	}
+	if r.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", r.AcceptEncoding)
+	}
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
 	q := req.URL.Query()
-	for k, v := range r.queries {
+	for k, v := range r.Queries {
 		q.Add(k, v)
 	}
 	req.URL.RawQuery = q.Encode()
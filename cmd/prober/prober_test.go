@@ -0,0 +1,273 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestClient returns the prober's HTTP client with the default flags.
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	client, err := newHTTPClient()
+	if err != nil {
+		t.Fatalf("newHTTPClient: %v", err)
+	}
+	return client
+}
+
+// statusServer returns a server that answers every request with code.
+func statusServer(t *testing.T, code int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		io.WriteString(w, "{}")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// histogramCount returns how many observations h has for labels.
+func histogramCount(t *testing.T, h *prometheus.HistogramVec, labels prometheus.Labels) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.With(labels).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("writing metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestObserveRequestStatusCodes(t *testing.T) {
+	client := newTestClient(t)
+	tests := []struct {
+		name     string
+		code     int
+		expected []int
+		wantErr  bool
+	}{
+		{name: "ok", code: http.StatusOK},
+		{name: "created", code: http.StatusCreated},
+		{name: "not found", code: http.StatusNotFound, wantErr: true},
+		{name: "server error", code: http.StatusServiceUnavailable, wantErr: true},
+		{name: "expected not found", code: http.StatusNotFound, expected: []int{http.StatusNotFound}},
+		{name: "unexpected ok", code: http.StatusOK, expected: []int{http.StatusNoContent}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := statusServer(t, tt.code)
+			r := ReadProberCheck{Endpoint: "/api/v1/log", Method: GET, ExpectedStatus: tt.expected}
+
+			err := observeRequest(context.Background(), client, srv.URL, r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("observeRequest() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var statusErr *statusCodeError
+				if !errors.As(err, &statusErr) || statusErr.statusCode != tt.code {
+					t.Errorf("observeRequest() = %v, want a statusCodeError for %d", err, tt.code)
+				}
+				if reason := classifyError(err); reason != reasonHTTP {
+					t.Errorf("classifyError() = %q, want %q", reason, reasonHTTP)
+				}
+			}
+
+			labels := prometheus.Labels{
+				endpointLabel:   r.Endpoint,
+				hostLabel:       srv.URL,
+				statusCodeLabel: strconv.Itoa(tt.code),
+			}
+			if got := histogramCount(t, requestDurationHistogram, labels); got != 1 {
+				t.Errorf("prober_request_duration_seconds count = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestHTTPRequestSendsQueriesAndBody(t *testing.T) {
+	type received struct {
+		method, query, body, contentType, header string
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- received{
+			method:      r.Method,
+			query:       r.URL.Query().Encode(),
+			body:        string(b),
+			contentType: r.Header.Get("Content-Type"),
+			header:      r.Header.Get("X-Test"),
+		}
+	}))
+	defer srv.Close()
+
+	r := ReadProberCheck{
+		Endpoint: "/api/v1/log/entries/retrieve",
+		Method:   POST,
+		Body:     `{"hash":"sha256:abc"}`,
+		Queries:  map[string]string{"logIndex": "10", "b": "2"},
+		Headers:  map[string]string{"X-Test": "yes"},
+	}
+	if err := observeRequest(context.Background(), newTestClient(t), srv.URL, r); err != nil {
+		t.Fatalf("observeRequest() = %v", err)
+	}
+	want := received{
+		method:      POST,
+		query:       "b=2&logIndex=10",
+		body:        r.Body,
+		contentType: "application/json",
+		header:      "yes",
+	}
+	if g := <-got; g != want {
+		t.Errorf("server received %+v, want %+v", g, want)
+	}
+}
+
+func TestProbeOnceErrors(t *testing.T) {
+	client := newTestClient(t)
+	r := ReadProberCheck{Endpoint: "/api/v1/log", Method: GET}
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		defer func(d time.Duration) { requestTimeout = d }(requestTimeout)
+		requestTimeout = 50 * time.Millisecond
+
+		err := probeOnce(context.Background(), func(ctx context.Context) error {
+			return observeRequest(ctx, client, srv.URL, r)
+		})
+		var timeoutErr *timeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.timeout != requestTimeout {
+			t.Fatalf("probeOnce() = %v, want a timeoutError after %v", err, requestTimeout)
+		}
+		if reason := classifyError(err); reason != reasonTimeout {
+			t.Errorf("classifyError() = %q, want %q", reason, reasonTimeout)
+		}
+		if !isRetryable(err) {
+			t.Errorf("isRetryable() = false, want true")
+		}
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		err := probeOnce(context.Background(), func(ctx context.Context) error {
+			return observeRequest(ctx, client, srv.URL, r)
+		})
+		if err == nil {
+			t.Fatal("probeOnce() = nil, want an error")
+		}
+		if reason := classifyError(err); reason != reasonConnection {
+			t.Errorf("classifyError() = %q, want %q", reason, reasonConnection)
+		}
+	})
+}
+
+func TestRunProbeRecordsResults(t *testing.T) {
+	client := newTestClient(t)
+	ok, failing := statusServer(t, http.StatusOK), statusServer(t, http.StatusInternalServerError)
+	r := ReadProberCheck{Endpoint: "/api/v1/version", Method: GET}
+
+	probeRequestsCounter.Reset()
+	for _, host := range []string{ok.URL, failing.URL} {
+		host := host
+		runProbe(context.Background(), host, r.Endpoint, func(ctx context.Context) error {
+			return observeRequest(ctx, client, host, r)
+		})
+	}
+
+	want := `
+# HELP prober_requests_total Total number of probe attempts by result (success, failure or timeout).
+# TYPE prober_requests_total counter
+prober_requests_total{endpoint="/api/v1/version",host="` + failing.URL + `",result="failure"} 1
+prober_requests_total{endpoint="/api/v1/version",host="` + ok.URL + `",result="success"} 1
+`
+	if err := testutil.CollectAndCompare(probeRequestsCounter, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+// onlyConfiguredChecks disables the built-in and write probers for the
+// duration of the test, so that runProbers only probes the given checks.
+func onlyConfiguredChecks(t *testing.T) {
+	t.Helper()
+	rekor, fulcio, write := enableRekor, enableFulcio, runWriteProber
+	t.Cleanup(func() { enableRekor, enableFulcio, runWriteProber = rekor, fulcio, write })
+	enableRekor, enableFulcio, runWriteProber = false, false, false
+}
+
+func TestRunProbersOneTime(t *testing.T) {
+	onlyConfiguredChecks(t)
+	client := newTestClient(t)
+	check := func(host string) []ReadProberCheck {
+		return []ReadProberCheck{{Host: host, Endpoint: "/api/v1/log", Method: GET}}
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		srv := statusServer(t, http.StatusOK)
+		summary := runProbers(context.Background(), 1, 1, newLiveChecks(check(srv.URL)), client, nil)
+		if summary.err != nil {
+			t.Errorf("runProbers() err = %v, want nil", summary.err)
+		}
+		if len(summary.results) != 1 {
+			t.Errorf("runProbers() has %d results, want 1", len(summary.results))
+		}
+	})
+
+	t.Run("failing", func(t *testing.T) {
+		srv := statusServer(t, http.StatusInternalServerError)
+		summary := runProbers(context.Background(), 1, 1, newLiveChecks(check(srv.URL)), client, nil)
+		if !errors.Is(summary.err, errProbesFailed) {
+			t.Errorf("runProbers() err = %v, want %v", summary.err, errProbesFailed)
+		}
+	})
+
+	t.Run("one failing", func(t *testing.T) {
+		ok, failing := statusServer(t, http.StatusOK), statusServer(t, http.StatusInternalServerError)
+		checks := append(check(ok.URL), check(failing.URL)...)
+		summary := runProbers(context.Background(), 1, 1, newLiveChecks(checks), client, nil)
+		if !errors.Is(summary.err, errProbesFailed) {
+			t.Errorf("runProbers() err = %v, want %v", summary.err, errProbesFailed)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		defer func(d time.Duration) { deadline = d }(deadline)
+		deadline = 100 * time.Millisecond
+
+		summary := runProbers(context.Background(), 1, 1, newLiveChecks(check(srv.URL)), client, nil)
+		if !errors.Is(summary.err, errDeadlineExceeded) {
+			t.Errorf("runProbers() err = %v, want %v", summary.err, errDeadlineExceeded)
+		}
+	})
+}
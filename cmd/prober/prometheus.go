@@ -14,29 +14,743 @@
 
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/release-utils/version"
+)
 
 var (
-	endpointLabel   = "endpoint"
-	hostLabel       = "host"
-	statusCodeLabel = "status_code"
+	endpointLabel     = "endpoint"
+	hostLabel         = "host"
+	statusCodeLabel   = "status_code"
+	resultLabel       = "result"
+	reasonLabel       = "reason"
+	legLabel          = "leg"
+	protocolLabel     = "protocol"
+	roleLabel         = "role"
+	tlsVersionLabel   = "tls_version"
+	cipherLabel       = "cipher_suite"
+	configSourceLabel = "config_source"
+	endpointsLabel    = "endpoints"
+	fingerprintLabel  = "fingerprint"
+	targetLabel       = "target"
+	oidcIssuerLabel   = "oidc_issuer"
+	identityHashLabel = "identity_hash"
+
+	// traceIDLabel labels latency exemplars with the trace of the request.
+	traceIDLabel = "trace_id"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+	resultMissing = "missing"
+	resultInvalid = "invalid"
+	resultTimeout = "timeout"
 )
 
+// resultOf returns the result label of an operation that failed with err,
+// or succeeded if err is nil.
+func resultOf(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// defaultLatencyBuckets are the histogram buckets used when
+// --latency-buckets is not set (milliseconds).
+var defaultLatencyBuckets = []float64{0.0, 200.0, 400.0, 600.0, 800.0, 1000.0}
+
 var (
 	// Track latency for each endpoint
 	endpointLatenciesSummary = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name:       "api_endpoint_latency",
-			Help:       "API endpoint latency distributions (milliseconds).",
+			Help:       "Deprecated: use prober_request_duration_seconds. API endpoint latency distributions (milliseconds).",
 			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001, .999: 0.0001},
 		},
 		[]string{endpointLabel, hostLabel, statusCodeLabel},
 	)
 
-	endpointLatenciesHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	endpointLatenciesHistogram = newLatencyHistogram(defaultLatencyBuckets)
+
+	// Track latency for each endpoint in seconds, the Prometheus base
+	// unit. This replaces the millisecond metrics above.
+	requestDurationHistogram = newRequestDurationHistogram(defaultLatencyBuckets)
+
+	// Track the time to the first byte of each response, which leaves out
+	// the transfer time of the rest of it.
+	ttfbHistogram = newTTFBHistogram(defaultLatencyBuckets)
+
+	// Count the result of every probe attempt
+	probeRequestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_requests_total",
+		Help: "Total number of probe attempts by result (success, failure or timeout).",
+	},
+		[]string{endpointLabel, hostLabel, resultLabel})
+
+	// Count failed probes by the reason they failed
+	probeFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_request_failures_total",
+		Help: "Total number of failed probe attempts by reason (dns, tls, tls_downgrade, timeout, connection, http, truncated_response, verification, validation or other).",
+	},
+		[]string{endpointLabel, hostLabel, reasonLabel})
+
+	// Count how often probes are retried under --retries
+	probeRetriesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_request_retries_total",
+		Help: "Total number of probe attempts that failed with a transient error and were retried.",
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Count the result of verifying probe responses
+	verificationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_verification_total",
+		Help: "Total number of response verifications by result (success or failure).",
+	},
+		[]string{endpointLabel, hostLabel, resultLabel})
+
+	// Count the result of validating response bodies
+	validationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_validation_total",
+		Help: "Total number of response body validations by result (success or failure).",
+	},
+		[]string{endpointLabel, hostLabel, resultLabel})
+
+	// Track how long requests wait on --max-rps
+	rateLimitWaitHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "prober_rate_limit_wait_seconds",
+		Help:    "Time requests spent waiting for the --max-rps rate limiter (seconds).",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30},
+	})
+
+	// Track where the time spent setting up connections goes
+	dnsLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "prober_dns_seconds",
+		Help: "DNS lookup latency distribution by host (seconds).",
+	},
+		[]string{hostLabel})
+	connectLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "prober_connect_seconds",
+		Help: "TCP connect latency distribution by host (seconds).",
+	},
+		[]string{hostLabel})
+	tlsHandshakeLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "prober_tls_handshake_seconds",
+		Help: "TLS handshake latency distribution by host (seconds).",
+	},
+		[]string{hostLabel})
+
+	// Count the result of checking the SCT on certificates Fulcio issues
+	sctVerificationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_sct_verification_total",
+		Help: "Total number of Fulcio certificates whose SCT was checked, by result (success, missing or invalid).",
+	},
+		[]string{hostLabel, resultLabel})
+
+	// Track how long until the TLS certificate of each host expires
+	tlsCertExpiryGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_tls_cert_expiry_seconds",
+		Help: "Seconds until the TLS certificate presented by the host expires.",
+	},
+		[]string{hostLabel})
+
+	// Track the TLS version and cipher suite each host negotiates
+	tlsConnectionInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_tls_connection_info",
+		Help: "Always 1, labeled by the TLS version and cipher suite most recently negotiated with the host.",
+	},
+		[]string{hostLabel, tlsVersionLabel, cipherLabel})
+
+	// Track how far each host's clock is from ours
+	clockSkewGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_server_clock_skew_seconds",
+		Help: "Difference between the time in the host's Date response header and the prober's clock (seconds). Positive values mean the host is ahead.",
+	},
+		[]string{hostLabel})
+
+	// Track how often requests are hedged, and how often the hedge wins
+	hedgedRequestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_hedged_requests_total",
+		Help: "Total number of requests that had a second copy sent because they had not responded within --hedge-after.",
+	},
+		[]string{endpointLabel, hostLabel})
+	hedgeWinsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_hedge_wins_total",
+		Help: "Total number of hedged requests where the second copy responded first.",
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track how long each probe cycle takes, to spot cycles falling behind
+	// -frequency
+	cycleDurationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prober_cycle_duration_seconds",
+		Help: "How long the most recent probe cycle took to run (seconds).",
+	})
+
+	// Track whether the most recent probe of each endpoint succeeded
+	endpointUpGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_endpoint_up",
+		Help: "Whether the most recent probe of the endpoint succeeded (1) or failed (0).",
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track how large the responses of each endpoint are
+	responseBytesHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prober_response_bytes",
+		Help:    "Response body size distribution by endpoint (bytes).",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track how many bytes the responses of each endpoint took on the wire
+	responseWireBytesHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prober_response_wire_bytes",
+		Help:    "Response body size on the wire, before decompression, by endpoint (bytes). Only recorded when the wire size is known, see acceptEncoding.",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track which HTTP version each host actually served probes over
+	httpResponsesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_http_responses_total",
+		Help: "Total number of probe responses by the negotiated HTTP protocol, such as HTTP/1.1 or HTTP/2.0.",
+	},
+		[]string{hostLabel, protocolLabel})
+
+	// Count redirects followed by probes, which often point at a
+	// misconfigured ingress
+	redirectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_redirects_total",
+		Help: "Total number of redirects probes of the endpoint were sent.",
+	},
+		[]string{hostLabel, endpointLabel})
+
+	// Track when each endpoint was last probed successfully
+	lastSuccessGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_last_success_timestamp_seconds",
+		Help: "Unix time of the most recent successful probe of the endpoint.",
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track the size and freshness of the CT log's signed tree head
+	ctlogTreeSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_ctlog_tree_size",
+		Help: "Tree size of the most recent signed tree head returned by the CT log.",
+	},
+		[]string{hostLabel})
+	ctlogSTHAgeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_ctlog_sth_age_seconds",
+		Help: "Seconds since the timestamp of the most recent signed tree head returned by the CT log.",
+	},
+		[]string{hostLabel})
+
+	// Track whether Rekor's log is growing and correctly signed
+	rekorTreeSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_rekor_tree_size",
+		Help: "Tree size of the most recent signed tree head returned by Rekor.",
+	},
+		[]string{hostLabel})
+	rekorSTHAgeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_rekor_sth_age_seconds",
+		Help: "Seconds since the prober last saw the tree size of Rekor's signed tree head advance.",
+	},
+		[]string{hostLabel})
+	rekorEntriesRateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_rekor_entries_rate",
+		Help: "Entries added to Rekor's log per minute, over the last --tree-size-samples signed tree heads.",
+	},
+		[]string{hostLabel})
+	rekorTreeSizeDecreasesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_rekor_tree_size_decreases_total",
+		Help: "Total number of times the tree size of Rekor's signed tree head went backwards within the same tree, which should never happen. A new tree after a shard rotation is not counted.",
+	},
+		[]string{hostLabel})
+	rekorSTHSignatureFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_rekor_sth_signature_failures_total",
+		Help: "Total number of Rekor signed tree heads that failed verification against the log's public key.",
+	},
+		[]string{hostLabel})
+	rekorConsistencyCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_rekor_consistency_total",
+		Help: "Total number of consistency checks between successive Rekor tree heads, by result (success or failure).",
+	},
+		[]string{hostLabel, resultLabel})
+
+	// Track how long until the TUF repository's metadata expires
+	tufExpiryGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_tuf_metadata_expiry_seconds",
+		Help: "Seconds until the TUF metadata for the role expires. Negative values mean it has already expired.",
+	},
+		[]string{hostLabel, roleLabel})
+
+	// Track the end-to-end prober
+	e2eLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prober_e2e_seconds",
+		Help:    "Time taken to get a Fulcio certificate, log a signature with it to Rekor and read it back (seconds).",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+	},
+		[]string{hostLabel})
+	e2eFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_e2e_failures_total",
+		Help: "Total number of failed end-to-end probes by the leg that failed (fulcio, rekor_upload, rekor_read or verification).",
+	},
+		[]string{hostLabel, legLabel})
+
+	// Count how often the write prober mints a new OIDC token
+	tokenRefreshCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_oidc_token_refreshes_total",
+		Help: "Total number of OIDC tokens minted by the ambient providers for the write prober, by result (success or failure).",
+	},
+		[]string{resultLabel})
+
+	// Track whether each TUF target matches its targets metadata
+	tufTargetVerificationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_tuf_target_verification_total",
+		Help: "Total number of downloads of each --tuf-target checked against the length and hashes in the targets metadata, by result (success or failure).",
+	},
+		[]string{hostLabel, targetLabel, resultLabel})
+
+	// Track changes of the Fulcio trust bundle between cycles
+	fulcioTrustBundleChangedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_fulcio_trust_bundle_changed_total",
+		Help: "Total number of times the fingerprint of the Fulcio trust bundle changed between probes, by host.",
+	},
+		[]string{hostLabel})
+
+	// Track which trust bundle each Fulcio host is serving
+	fulcioTrustBundleInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_fulcio_trust_bundle_info",
+		Help: "A metric with a constant '1' value labeled by the SHA-256 fingerprint of the trust bundle the Fulcio host is currently serving.",
+	},
+		[]string{hostLabel, fingerprintLabel})
+
+	// Track the identity of the certificates issued to the write probers
+	fulcioCertIdentityInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_fulcio_cert_identity_info",
+		Help: "A metric with a constant '1' value labeled by the OIDC issuer and the truncated SHA-256 of the identity in the certificate the Fulcio host last issued to the write probers.",
+	},
+		[]string{hostLabel, oidcIssuerLabel, identityHashLabel})
+
+	// Track the circuit breaker of each endpoint
+	breakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_circuit_breaker_state",
+		Help: "State of the circuit breaker of the endpoint: 0 closed, 1 open or 2 half-open. Only exported with --breaker-failures.",
+	},
+		[]string{endpointLabel, hostLabel})
+
+	// Track probes whose request could not even be built
+	requestBuildErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_request_build_errors_total",
+		Help: "Total number of probes that failed before reaching the network because their request could not be built, such as for a bad method, URL or body template.",
+	},
+		[]string{endpointLabel})
+
+	// Track reloads of --config triggered by SIGHUP
+	configReloadCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prober_config_reloads_total",
+		Help: "Total number of attempts to reload the endpoints from --config on SIGHUP, by result (success or failure).",
+	},
+		[]string{resultLabel})
+
+	// Track where the endpoints being probed came from and how many there
+	// are, so that a config rollout can be confirmed
+	configInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prober_info",
+		Help: "A metric with a constant '1' value labeled by the source of the endpoints being probed (builtin or file) and how many endpoints were loaded from it.",
+	},
+		[]string{configSourceLabel, endpointsLabel})
+
+	// Track when the endpoints being probed were last loaded
+	configLoadTimeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prober_config_last_reload_timestamp_seconds",
+		Help: "Unix time at which the endpoints being probed were last loaded, at startup or on SIGHUP.",
+	})
+)
+
+// metricPrefix returns the prefix to add to every metric name for the given
+// namespace and subsystem, joined the same way as prometheus.Opts does.
+func metricPrefix(namespace, subsystem string) string {
+	var prefix string
+	for _, p := range []string{namespace, subsystem} {
+		if p != "" {
+			prefix += p + "_"
+		}
+	}
+	return prefix
+}
+
+// validateExtraLabels checks that the --extra-label labels are valid label
+// names that do not clash with the labels the prober's own metrics use.
+func validateExtraLabels(labels map[string]string) error {
+	reserved := map[string]bool{
+		"le": true, "quantile": true, "version": true, "git_commit": true,
+		"build_date": true, "go_version": true,
+	}
+	for _, l := range []string{endpointLabel, hostLabel, statusCodeLabel, resultLabel,
+		reasonLabel, legLabel, protocolLabel, roleLabel, tlsVersionLabel, cipherLabel,
+		configSourceLabel, endpointsLabel, fingerprintLabel, targetLabel, oidcIssuerLabel,
+		identityHashLabel, traceIDLabel} {
+		reserved[l] = true
+	}
+	for k := range labels {
+		if !model.LabelName(k).IsValid() || strings.HasPrefix(k, "__") {
+			return fmt.Errorf("invalid label name %q", k)
+		}
+		if reserved[k] {
+			return fmt.Errorf("label %q is already used by the prober's metrics", k)
+		}
+	}
+	return nil
+}
+
+// buildInfoGauge exports the version of the running prober as labels, in
+// the usual Prometheus build_info style.
+var buildInfoGauge = newBuildInfoGauge(version.GetVersionInfo())
+
+func newBuildInfoGauge(v version.Info) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "prober_build_info",
+		Help: "A metric with a constant '1' value labeled by the version, git commit, build date and Go version the prober was built with.",
+		ConstLabels: prometheus.Labels{
+			"version":    v.GitVersion,
+			"git_commit": v.GitCommit,
+			"build_date": v.BuildDate,
+			"go_version": v.GoVersion,
+		},
+	}, func() float64 { return 1 })
+}
+
+func newLatencyHistogram(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "api_endpoint_latency_histogram",
-		Help:    "API endpoint latency distribution across Rekor and Fulcio (milliseconds)",
-		Buckets: []float64{0.0, 200.0, 400.0, 600.0, 800.0, 1000.0},
+		Help:    "Deprecated: use prober_request_duration_seconds. API endpoint latency distribution across Rekor and Fulcio (milliseconds)",
+		Buckets: buckets,
 	},
 		[]string{endpointLabel, hostLabel, statusCodeLabel})
-)
+}
+
+// newRequestDurationHistogram returns the latency histogram in seconds,
+// with the given bucket boundaries in milliseconds, as they are given to
+// --latency-buckets.
+func newRequestDurationHistogram(msBuckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prober_request_duration_seconds",
+		Help:    "API endpoint latency distribution (seconds).",
+		Buckets: secondsBuckets(msBuckets),
+	},
+		[]string{endpointLabel, hostLabel, statusCodeLabel})
+}
+
+// newTTFBHistogram returns the time to first byte histogram, with the same
+// buckets as newRequestDurationHistogram.
+func newTTFBHistogram(msBuckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prober_ttfb_seconds",
+		Help:    "API endpoint time to first response byte distribution (seconds).",
+		Buckets: secondsBuckets(msBuckets),
+	},
+		[]string{endpointLabel, hostLabel})
+}
+
+// secondsBuckets converts bucket boundaries in milliseconds to seconds.
+func secondsBuckets(msBuckets []float64) []float64 {
+	buckets := make([]float64, 0, len(msBuckets))
+	for _, b := range msBuckets {
+		buckets = append(buckets, b/1000)
+	}
+	return buckets
+}
+
+// parseLatencyBuckets parses a comma-separated list of strictly increasing
+// bucket boundaries in milliseconds. An empty list yields the default
+// buckets.
+func parseLatencyBuckets(s string) ([]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return defaultLatencyBuckets, nil
+	}
+	var buckets []float64
+	for _, f := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", f, err)
+		}
+		if len(buckets) > 0 && b <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be strictly increasing, got %v after %v", b, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// writeMetrics writes the metrics gathered from g to w in the Prometheus
+// text format.
+func writeMetrics(w io.Writer, g prometheus.Gatherer) error {
+	families, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics: %w", err)
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportDataToPrometheus records the latency of a single request to the
+// given host and endpoint, and mirrors it to any other metrics sinks. If the
+// request was traced, the trace ID is attached to the histogram observation
+// as an exemplar.
+func exportDataToPrometheus(ctx context.Context, host, endpoint string, statusCode int, latency int64) {
+	for _, s := range sinks {
+		s.observeLatency(host, endpoint, statusCode, latency)
+	}
+
+	labels := prometheus.Labels{
+		endpointLabel:   endpoint,
+		statusCodeLabel: fmt.Sprintf("%d", statusCode),
+		hostLabel:       host,
+	}
+	observeWithExemplar(ctx, requestDurationHistogram.With(labels), float64(latency)/1000)
+	if legacyLatencyMetrics {
+		endpointLatenciesSummary.With(labels).Observe(float64(latency))
+		observeWithExemplar(ctx, endpointLatenciesHistogram.With(labels), float64(latency))
+	}
+}
+
+// exportGetResult logs and exports the latency of a request to endpoint on
+// host made with getBody or getJSON, which returned err. Requests that got
+// a response are exported with its status code, and those that got none,
+// such as on a connection error, are not exported at all.
+func exportGetResult(ctx context.Context, host, endpoint string, latency int64, err error) {
+	statusCode := http.StatusOK
+	var statusCodeErr *statusCodeError
+	switch {
+	case errors.As(err, &statusCodeErr):
+		statusCode = statusCodeErr.statusCode
+	case err != nil:
+		return
+	}
+	logRequest(host, endpoint, statusCode, latency)
+	exportDataToPrometheus(ctx, host, endpoint, statusCode, latency)
+}
+
+// observeWithExemplar observes v, attaching the trace ID as an exemplar if
+// ctx carries a sampled trace.
+func observeWithExemplar(ctx context.Context, observer prometheus.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{traceIDLabel: sc.TraceID().String()})
+		return
+	}
+	observer.Observe(v)
+}
+
+// recordResponseSize records the decompressed size of the response body
+// returned by a probe, and its size on the wire unless that is negative
+// because it is not known.
+func recordResponseSize(host, endpoint string, size, wireSize int) {
+	labels := prometheus.Labels{
+		endpointLabel: endpoint,
+		hostLabel:     host,
+	}
+	responseBytesHistogram.With(labels).Observe(float64(size))
+	if wireSize >= 0 {
+		responseWireBytesHistogram.With(labels).Observe(float64(wireSize))
+	}
+}
+
+// recordBreakerState records the state of the circuit breaker of endpoint.
+func recordBreakerState(host, endpoint string, state breakerState) {
+	breakerStateGauge.With(prometheus.Labels{endpointLabel: endpoint, hostLabel: host}).Set(float64(state))
+}
+
+// recordRequestBuildError counts a probe of endpoint whose request could
+// not be built.
+func recordRequestBuildError(endpoint string) {
+	requestBuildErrorsCounter.With(prometheus.Labels{endpointLabel: endpoint}).Inc()
+}
+
+// recordHedge counts a request to endpoint that was hedged.
+func recordHedge(host, endpoint string) {
+	hedgedRequestsCounter.With(prometheus.Labels{endpointLabel: endpoint, hostLabel: host}).Inc()
+}
+
+// recordHedgeWin counts a hedged request to endpoint where the hedge
+// responded first.
+func recordHedgeWin(host, endpoint string) {
+	hedgeWinsCounter.With(prometheus.Labels{endpointLabel: endpoint, hostLabel: host}).Inc()
+}
+
+// recordProbeRetry counts a failed attempt at probing endpoint that is
+// about to be retried.
+func recordProbeRetry(host, endpoint string) {
+	probeRetriesCounter.With(prometheus.Labels{endpointLabel: endpoint, hostLabel: host}).Inc()
+}
+
+// recordProbeResult counts a single probe attempt as a success, failure or
+// timeout, and marks the endpoint as up or down. Failures are also counted
+// by reason, and successes update the last success time. The result is
+// mirrored to any other metrics sinks.
+func recordProbeResult(host, endpoint string, err error) {
+	result := resultSuccess
+	var timeoutErr *timeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		result = resultTimeout
+	case err != nil:
+		result = resultFailure
+	}
+	var reason string
+	if err != nil {
+		reason = classifyError(err)
+	}
+	for _, s := range sinks {
+		s.countResult(host, endpoint, result, reason)
+	}
+
+	probeRequestsCounter.With(prometheus.Labels{
+		endpointLabel: endpoint,
+		hostLabel:     host,
+		resultLabel:   result,
+	}).Inc()
+	if err != nil {
+		probeFailuresCounter.With(prometheus.Labels{
+			endpointLabel: endpoint,
+			hostLabel:     host,
+			reasonLabel:   reason,
+		}).Inc()
+	}
+
+	labels := prometheus.Labels{
+		endpointLabel: endpoint,
+		hostLabel:     host,
+	}
+	up := 0.0
+	if err == nil {
+		up = 1
+		lastSuccessGauge.With(labels).SetToCurrentTime()
+	}
+	endpointUpGauge.With(labels).Set(up)
+}
+
+// recordVerificationResult counts a single verification of a probe's
+// response as a success or failure.
+func recordVerificationResult(host, endpoint string, err error) {
+	verificationCounter.With(prometheus.Labels{
+		endpointLabel: endpoint,
+		hostLabel:     host,
+		resultLabel:   resultOf(err),
+	}).Inc()
+}
+
+// recordValidationResult counts a single validation of a probe's response
+// body as a success or failure.
+func recordValidationResult(host, endpoint string, err error) {
+	validationCounter.With(prometheus.Labels{
+		endpointLabel: endpoint,
+		hostLabel:     host,
+		resultLabel:   resultOf(err),
+	}).Inc()
+}
+
+// recordSCTResult counts the result of checking the SCT on a certificate
+// issued by the Fulcio at host.
+func recordSCTResult(host string, err error) {
+	result := resultSuccess
+	switch {
+	case errors.Is(err, errNoSCT):
+		result = resultMissing
+	case err != nil:
+		result = resultInvalid
+	}
+	sctVerificationCounter.With(prometheus.Labels{hostLabel: host, resultLabel: result}).Inc()
+}
+
+// recordTLSCertExpiry records when the leaf certificate presented by host
+// expires. It does nothing for plaintext connections.
+func recordTLSCertExpiry(host string, state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	expiry := time.Until(state.PeerCertificates[0].NotAfter)
+	tlsCertExpiryGauge.With(prometheus.Labels{hostLabel: host}).Set(expiry.Seconds())
+}
+
+// tlsConnections holds the labels last recorded for each host in
+// prober_tls_connection_info, so that the series is replaced rather than
+// added to when the host negotiates something different.
+var tlsConnections = struct {
+	sync.Mutex
+	labels map[string]prometheus.Labels
+}{labels: map[string]prometheus.Labels{}}
+
+// recordTLSConnection records the TLS version and cipher suite negotiated
+// with host. It does nothing for plaintext connections.
+func recordTLSConnection(host string, state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+	labels := prometheus.Labels{
+		hostLabel:       host,
+		tlsVersionLabel: tlsVersionName(state.Version),
+		cipherLabel:     tls.CipherSuiteName(state.CipherSuite),
+	}
+	tlsConnections.Lock()
+	defer tlsConnections.Unlock()
+	if prev, ok := tlsConnections.labels[host]; ok {
+		tlsConnectionInfoGauge.Delete(prev)
+	}
+	tlsConnections.labels[host] = labels
+	tlsConnectionInfoGauge.With(labels).Set(1)
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	default:
+		return fmt.Sprintf("0x%04x", v)
+	}
+}
+
+// recordHTTPProtocol records the protocol, such as HTTP/2.0, that a
+// response from host was served over.
+func recordHTTPProtocol(host, proto string) {
+	httpResponsesCounter.With(prometheus.Labels{hostLabel: host, protocolLabel: proto}).Inc()
+}
+
+// recordClockSkew records how far the Date header of a response from host,
+// received at now, is from the local clock. Responses without a valid Date
+// header are skipped.
+func recordClockSkew(host string, header http.Header, now time.Time) {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// Date only has second precision.
+	skew := date.Sub(now.Truncate(time.Second))
+	clockSkewGauge.With(prometheus.Labels{hostLabel: host}).Set(skew.Seconds())
+}
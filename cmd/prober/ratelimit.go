@@ -0,0 +1,89 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// requestLimiter bounds the rate of every request the probers make to
+// --max-rps. It is nil, and requests are not limited, when --max-rps is 0.
+var requestLimiter *rate.Limiter
+
+// newRequestLimiter returns a limiter allowing maxRPS requests per second,
+// or nil if maxRPS is 0.
+func newRequestLimiter(maxRPS float64) *rate.Limiter {
+	if maxRPS <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(maxRPS), int(math.Ceil(maxRPS)))
+}
+
+// waitForRequest blocks until requestLimiter allows another request, and
+// records how long that took. Requests are delayed rather than dropped.
+func waitForRequest(ctx context.Context) error {
+	if requestLimiter == nil {
+		return nil
+	}
+	s := time.Now()
+	err := requestLimiter.Wait(ctx)
+	rateLimitWaitHistogram.Observe(time.Since(s).Seconds())
+	return err
+}
+
+// admittedKey is the context key of the admission left by admitRequest.
+type admittedKey struct{}
+
+// admitRequest waits for requestLimiter like waitForRequest, and returns a
+// copy of ctx whose next request rateLimitTransport lets through without
+// waiting again. Probes call it before they start timing a request, so that
+// time queued behind --max-rps is not counted as latency.
+func admitRequest(ctx context.Context) (context.Context, error) {
+	if requestLimiter == nil {
+		return ctx, nil
+	}
+	if err := waitForRequest(ctx); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, admittedKey{}, new(int32)), nil
+}
+
+// takeAdmission reports whether ctx carries an admission from admitRequest
+// that has not been used yet, and uses it up.
+func takeAdmission(ctx context.Context) bool {
+	admitted, ok := ctx.Value(admittedKey{}).(*int32)
+	return ok && atomic.CompareAndSwapInt32(admitted, 0, 1)
+}
+
+// rateLimitTransport holds every request back until requestLimiter allows
+// it, unless the request was already admitted by admitRequest.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !takeAdmission(req.Context()) {
+		if err := waitForRequest(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitWaitIsNotLatency(t *testing.T) {
+	defer func(l *rate.Limiter, d time.Duration) { requestLimiter, hedgeAfter = l, d }(requestLimiter, hedgeAfter)
+	// One request every 300ms, with the only token already taken, so that
+	// the probe has to queue.
+	requestLimiter = rate.NewLimiter(rate.Every(300*time.Millisecond), 1)
+	requestLimiter.Allow()
+	hedgeAfter = 50 * time.Millisecond
+	hedgedRequestsCounter.Reset()
+
+	srv := statusServer(t, http.StatusOK)
+	r := ReadProberCheck{Endpoint: "/api/v1/log", Method: GET}
+	s := time.Now()
+	if err := observeRequest(context.Background(), newTestClient(t), srv.URL, r); err != nil {
+		t.Fatalf("observeRequest() = %v", err)
+	}
+	if elapsed := time.Since(s); elapsed < 200*time.Millisecond {
+		t.Fatalf("observeRequest() took %v, want it to wait for the limiter", elapsed)
+	}
+	if elapsed := time.Since(s); elapsed > 500*time.Millisecond {
+		// A second wait in the transport would take another 300ms.
+		t.Errorf("observeRequest() took %v, want the request to wait for the limiter once", elapsed)
+	}
+
+	var m dto.Metric
+	labels := prometheus.Labels{endpointLabel: r.Endpoint, hostLabel: srv.URL, statusCodeLabel: strconv.Itoa(http.StatusOK)}
+	if err := requestDurationHistogram.With(labels).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("writing metric: %v", err)
+	}
+	if got := m.GetHistogram().GetSampleSum(); got > 0.1 {
+		t.Errorf("prober_request_duration_seconds = %vs, want the limiter wait left out", got)
+	}
+	if n := testutil.CollectAndCount(hedgedRequestsCounter); n != 0 {
+		t.Errorf("prober_hedged_requests_total has %d series, want the limiter wait not to trigger a hedge", n)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxRedirects is how many redirects a probe follows, the same as the
+// default for http.Client.
+const maxRedirects = 10
+
+type probeTargetKey struct{}
+
+// probeTarget is the host and endpoint label of the probe a request is made
+// for.
+type probeTarget struct {
+	host     string
+	endpoint string
+}
+
+// withProbeTarget returns a copy of ctx that carries the host and endpoint
+// labels of the probe, so that requests made within it can be attributed to
+// the probe.
+func withProbeTarget(ctx context.Context, host, endpoint string) context.Context {
+	return context.WithValue(ctx, probeTargetKey{}, probeTarget{host: host, endpoint: endpoint})
+}
+
+// checkRedirect counts and logs each redirect a probe follows. With
+// --fail-on-redirect set redirects are not followed, and the probe fails.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	target, ok := req.Context().Value(probeTargetKey{}).(probeTarget)
+	if !ok {
+		target = probeTarget{host: via[0].URL.Host, endpoint: via[0].URL.Path}
+	}
+	redirectsCounter.With(prometheus.Labels{hostLabel: target.host, endpointLabel: target.endpoint}).Inc()
+	logger.Infow("probe redirected", "host", target.host, "endpoint", target.endpoint, "from", via[len(via)-1].URL.Redacted(), "to", req.URL.Redacted())
+	if failOnRedirect {
+		return fmt.Errorf("redirected to %s with --fail-on-redirect set", req.URL.Redacted())
+	}
+	return nil
+}
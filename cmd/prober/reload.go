@@ -0,0 +1,100 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// liveChecks holds the endpoints being probed, so that they can be swapped
+// for the ones in a reloaded config between probe cycles.
+type liveChecks struct {
+	sync.Mutex
+	checks []ReadProberCheck
+}
+
+func newLiveChecks(checks []ReadProberCheck) *liveChecks {
+	return &liveChecks{checks: checks}
+}
+
+func (l *liveChecks) get() []ReadProberCheck {
+	l.Lock()
+	defer l.Unlock()
+	return l.checks
+}
+
+func (l *liveChecks) set(checks []ReadProberCheck) {
+	l.Lock()
+	defer l.Unlock()
+	l.checks = checks
+}
+
+// notifySIGHUP returns a channel that receives SIGHUP. It is called at the
+// start of main, as until it is the default action of SIGHUP, exiting, is
+// in effect. stop stops the delivery.
+func notifySIGHUP() (hup <-chan os.Signal, stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c, func() { signal.Stop(c) }
+}
+
+// reloadOnSIGHUP reloads the endpoints from --config into live every time
+// hup receives SIGHUP, until ctx is done. A config that fails to load or
+// validate is logged and the current endpoints are kept. A SIGHUP received
+// before reloadOnSIGHUP starts reloads the config as soon as it does.
+func reloadOnSIGHUP(ctx context.Context, hup <-chan os.Signal, live *liveChecks) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		checks, err := loadChecks(configFile)
+		recordConfigReload(err)
+		if err != nil {
+			logger.Errorw("reloading config, keeping the current endpoints", "error", err)
+			continue
+		}
+		live.set(checks)
+		recordConfigInfo(checks)
+		logger.Infow("reloaded config", "endpoints", len(checks))
+	}
+}
+
+func recordConfigReload(err error) {
+	configReloadCounter.With(prometheus.Labels{resultLabel: resultOf(err)}).Inc()
+}
+
+// recordConfigInfo records the source of the endpoints being probed, how
+// many there are and when they were loaded.
+func recordConfigInfo(checks []ReadProberCheck) {
+	source := "builtin"
+	if configFile != "" {
+		source = "file"
+	}
+	configInfoGauge.Reset()
+	configInfoGauge.With(prometheus.Labels{
+		configSourceLabel: source,
+		endpointsLabel:    fmt.Sprintf("%d", len(checks)),
+	}).Set(1)
+	configLoadTimeGauge.SetToCurrentTime()
+}
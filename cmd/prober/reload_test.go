@@ -0,0 +1,62 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	config := "- host: https://rekor.example.com\n  endpoint: /api/v1/log\n  method: GET\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A SIGHUP that arrives before reloadOnSIGHUP starts must neither kill
+	// the process nor be lost.
+	hup, stop := notifySIGHUP()
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	live := newLiveChecks(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloadOnSIGHUP(ctx, hup, live)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(live.get()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the endpoints were not reloaded after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := live.get()[0].Host; got != "https://rekor.example.com" {
+		t.Errorf("reloaded host = %q, want https://rekor.example.com", got)
+	}
+}
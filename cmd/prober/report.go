@@ -0,0 +1,113 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// report is the JSON document written to --report-file at the end of a
+// -one-time run.
+type report struct {
+	// Result is success if every probe passed, and failure otherwise.
+	Result string        `json:"result"`
+	Error  string        `json:"error,omitempty"`
+	Time   time.Time     `json:"time"`
+	Probes []probeReport `json:"probes"`
+}
+
+// probeReport is the outcome of a single probe. StatusCode and LatencyMs are
+// those of the last request the probe made, and are left out if it never got
+// a response.
+type probeReport struct {
+	Host       string `json:"host"`
+	Endpoint   string `json:"endpoint"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMs  *int64 `json:"latencyMs,omitempty"`
+	Result     string `json:"result"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// reportSink is a metrics sink that remembers the last latency and status
+// code observed for each probe, to fill in the report.
+type reportSink struct {
+	sync.Mutex
+	responses map[string]probeReport
+}
+
+func newReportSink() *reportSink {
+	return &reportSink{responses: map[string]probeReport{}}
+}
+
+func (s *reportSink) observeLatency(host, endpoint string, statusCode int, latency int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.responses[host+endpoint] = probeReport{StatusCode: statusCode, LatencyMs: &latency}
+}
+
+// countResult does nothing, the results are taken from the probe summary so
+// that the report matches the exit status.
+func (s *reportSink) countResult(_, _, _, _ string) {}
+
+// write writes the report of summary, the outcome of a -one-time run, to
+// path.
+func (s *reportSink) write(path string, jobs []probeJob, summary probeSummary) error {
+	s.Lock()
+	defer s.Unlock()
+	r := report{Result: resultSuccess, Time: time.Now().UTC(), Probes: []probeReport{}}
+	if summary.err != nil {
+		r.Result = resultFailure
+		r.Error = summary.err.Error()
+	}
+	for _, j := range jobs {
+		err, ok := summary.results[j.key()]
+		if !ok {
+			continue
+		}
+		p := s.responses[j.key()]
+		p.Host, p.Endpoint = j.host, j.endpoint
+		// Drop the description from labels such as "/api/v1/log (sth)".
+		path, _, _ := strings.Cut(j.endpoint, " (")
+		p.URL = j.host + path
+		p.Result = resultSuccess
+		if err != nil {
+			p.Result, p.Reason, p.Error = resultFailure, classifyError(err), err.Error()
+		}
+		r.Probes = append(r.Probes, p)
+	}
+	sort.SliceStable(r.Probes, func(i, j int) bool {
+		if r.Probes[i].Host != r.Probes[j].Host {
+			return r.Probes[i].Host < r.Probes[j].Host
+		}
+		return r.Probes[i].Endpoint < r.Probes[j].Endpoint
+	})
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
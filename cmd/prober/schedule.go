@@ -0,0 +1,233 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// scheduler decides which probes are due on each tick of the prober loop.
+// Probes without an interval run on every tick, the others only once their
+// interval has elapsed since they last ran.
+//
+// If maxBackoff is set, probes that fail are backed off exponentially, with
+// jitter, up to maxBackoff, and go back to their normal interval once they
+// succeed. This is tracked per probe so a single failing endpoint does not
+// slow down the healthy ones.
+//
+// If breakerFailures is set, a probe that fails that many times in a row
+// trips its circuit breaker open, and is then only run every
+// breakerInterval. The next run is half-open: if it succeeds the breaker
+// closes and the probe goes back to its normal interval, otherwise the
+// breaker opens again.
+type scheduler struct {
+	// base is the interval of probes that do not set their own.
+	base            time.Duration
+	maxBackoff      time.Duration
+	breakerFailures int
+	breakerInterval time.Duration
+	rand            *rand.Rand
+
+	lastRun  map[string]time.Time
+	failures map[string]int
+	backoff  map[string]time.Duration
+	breakers map[string]breakerState
+
+	// order is the shuffled order that --sample-fraction takes probes in,
+	// and next is where the following cycle starts in it.
+	order []string
+	next  int
+}
+
+// breakerState is the state of the circuit breaker of a probe, exported as
+// the value of prober_circuit_breaker_state.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func newScheduler(base, maxBackoff time.Duration, breakerFailures int, breakerInterval time.Duration) *scheduler {
+	return &scheduler{
+		base:            base,
+		maxBackoff:      maxBackoff,
+		breakerFailures: breakerFailures,
+		breakerInterval: breakerInterval,
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		lastRun:         map[string]time.Time{},
+		failures:        map[string]int{},
+		backoff:         map[string]time.Duration{},
+		breakers:        map[string]breakerState{},
+	}
+}
+
+// due returns the jobs that should run at now, and records them as run.
+func (s *scheduler) due(jobs []probeJob, now time.Time) []probeJob {
+	var due []probeJob
+	for _, j := range jobs {
+		interval := j.interval
+		if b := s.backoff[j.key()]; b > interval {
+			interval = b
+		}
+		open := s.breakers[j.key()] == breakerOpen
+		if open && s.breakerInterval > interval {
+			interval = s.breakerInterval
+		}
+		last, ok := s.lastRun[j.key()]
+		if interval > 0 && ok && now.Sub(last) < interval {
+			continue
+		}
+		s.lastRun[j.key()] = now
+		if open {
+			s.setBreaker(j, breakerHalfOpen)
+		}
+		due = append(due, j)
+	}
+	return due
+}
+
+// sample returns the given fraction of jobs, rounded up. Jobs are taken in
+// a shuffled order that each call carries on through from where the last
+// one stopped, so that every job is returned once every 1/fraction calls
+// and none is starved. The order is reshuffled whenever the set of jobs
+// changes, such as when the config is reloaded.
+func (s *scheduler) sample(jobs []probeJob, fraction float64) []probeJob {
+	if fraction >= 1 || len(jobs) == 0 {
+		return jobs
+	}
+	byKey := make(map[string]probeJob, len(jobs))
+	for _, j := range jobs {
+		byKey[j.key()] = j
+	}
+	if !s.sameOrder(byKey) {
+		s.order = s.order[:0]
+		for k := range byKey {
+			s.order = append(s.order, k)
+		}
+		s.rand.Shuffle(len(s.order), func(i, j int) {
+			s.order[i], s.order[j] = s.order[j], s.order[i]
+		})
+		s.next = 0
+	}
+
+	n := int(math.Ceil(fraction * float64(len(s.order))))
+	sampled := make([]probeJob, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, byKey[s.order[(s.next+i)%len(s.order)]])
+	}
+	s.next = (s.next + n) % len(s.order)
+	return sampled
+}
+
+// sameOrder reports whether the sampling order holds exactly the keys of
+// jobs.
+func (s *scheduler) sameOrder(jobs map[string]probeJob) bool {
+	if len(s.order) != len(jobs) {
+		return false
+	}
+	for _, k := range s.order {
+		if _, ok := jobs[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// record updates the backoff and circuit breaker of each of jobs from the
+// result of its last run, given as a map from job key to error. Jobs without
+// a result are left as they are.
+func (s *scheduler) record(jobs []probeJob, results map[string]error) {
+	for _, j := range jobs {
+		err, ok := results[j.key()]
+		switch {
+		case !ok:
+		case err == nil:
+			delete(s.failures, j.key())
+			delete(s.backoff, j.key())
+			s.setBreaker(j, breakerClosed)
+		default:
+			s.failures[j.key()]++
+			if s.maxBackoff > 0 {
+				base := j.interval
+				if base <= 0 {
+					base = s.base
+				}
+				s.backoff[j.key()] = s.nextBackoff(base, s.failures[j.key()])
+			}
+			if s.breakerFailures > 0 && s.failures[j.key()] >= s.breakerFailures {
+				s.setBreaker(j, breakerOpen)
+			}
+		}
+	}
+}
+
+// setBreaker moves the circuit breaker of j to state, if circuit breakers
+// are enabled.
+func (s *scheduler) setBreaker(j probeJob, state breakerState) {
+	if s.breakerFailures <= 0 {
+		return
+	}
+	prev := s.breakers[j.key()]
+	if state == breakerOpen && prev != breakerOpen && prev != breakerHalfOpen {
+		logger.Warnw("opening circuit breaker", "host", j.host, "endpoint", j.endpoint, "failures", s.failures[j.key()], "interval", s.breakerInterval.String())
+	}
+	if state == breakerClosed && prev != breakerClosed {
+		logger.Infow("closing circuit breaker", "host", j.host, "endpoint", j.endpoint)
+	}
+	s.breakers[j.key()] = state
+	recordBreakerState(j.host, j.endpoint, state)
+}
+
+// nextBackoff returns how long to wait before retrying a probe with the
+// given interval that has failed the given number of times in a row: the
+// interval doubled for every failure after the first, capped at maxBackoff,
+// with equal jitter so that the wait is between half and all of that.
+func (s *scheduler) nextBackoff(base time.Duration, failures int) time.Duration {
+	b := base
+	for i := 1; i < failures && b < s.maxBackoff; i++ {
+		b *= 2
+	}
+	if b > s.maxBackoff {
+		b = s.maxBackoff
+	}
+	half := b / 2
+	if half <= 0 {
+		return b
+	}
+	return half + time.Duration(s.rand.Int63n(int64(half)+1))
+}
+
+// jitter randomizes d by up to ±fraction of it, so that replicas of the
+// prober started at the same time spread their probes out.
+func (s *scheduler) jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return d + time.Duration((s.rand.Float64()*2-1)*fraction*float64(d))
+}
+
+// byPriority sorts jobs so that higher priority jobs run first, keeping the
+// order of jobs with the same priority.
+func byPriority(jobs []probeJob) []probeJob {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].priority > jobs[j].priority
+	})
+	return jobs
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/ctutil"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// sctHeader is the response header Fulcio returns a detached SCT in when
+// the SCT is not embedded in the certificate.
+const sctHeader = "SCT"
+
+// errNoSCT is returned by verifySCT when Fulcio returned no SCT at all.
+var errNoSCT = errors.New("no SCT embedded in the certificate or returned in the SCT header")
+
+// verifySCT checks that Fulcio returned an SCT for the leaf of chain, the
+// PEM certificate chain it issued, either embedded in the certificate or in
+// the detached SCT header. If --ctlog-public-key is set the signature on
+// the SCT is verified too.
+func verifySCT(chain []byte, header string) error {
+	certs, err := x509util.CertificatesFromPEM(chain)
+	if err != nil {
+		return fmt.Errorf("parsing certificate chain: %w", err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates in response")
+	}
+
+	embedded, err := x509util.ParseSCTsFromCertificate(certs[0].Raw)
+	if err != nil {
+		return fmt.Errorf("parsing embedded SCTs: %w", err)
+	}
+	var scts []*ct.SignedCertificateTimestamp
+	switch {
+	case len(embedded) > 0:
+		scts = embedded
+	case header != "":
+		b, err := base64.StdEncoding.DecodeString(header)
+		if err != nil {
+			return fmt.Errorf("decoding SCT header: %w", err)
+		}
+		var resp ct.AddChainResponse
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return fmt.Errorf("decoding SCT header: %w", err)
+		}
+		sct, err := resp.ToSignedCertificateTimestamp()
+		if err != nil {
+			return fmt.Errorf("parsing SCT header: %w", err)
+		}
+		scts = []*ct.SignedCertificateTimestamp{sct}
+	default:
+		return errNoSCT
+	}
+
+	if ctlogPublicKey == "" {
+		return nil
+	}
+	pub, err := ctlogKey()
+	if err != nil {
+		return err
+	}
+	// An embedded SCT covers the precertificate, which is rebuilt from the
+	// certificate and its issuer.
+	verifyChain := []*ctx509.Certificate{certs[0]}
+	if len(embedded) > 0 {
+		if len(certs) < 2 {
+			return fmt.Errorf("no issuer in the certificate chain to verify the embedded SCT with")
+		}
+		verifyChain = append(verifyChain, certs[1])
+	}
+	for _, sct := range scts {
+		if err := ctutil.VerifySCT(pub, verifyChain, sct, len(embedded) > 0); err != nil {
+			return fmt.Errorf("verifying SCT: %w", err)
+		}
+	}
+	return nil
+}
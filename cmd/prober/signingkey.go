@@ -0,0 +1,86 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/theupdateframework/go-tuf/encrypted"
+)
+
+// fixedSigningKey is the key loaded from --signing-key, or nil if the write
+// probers use a new key for every probe.
+var fixedSigningKey *ecdsa.PrivateKey
+
+// loadSigningKey reads the ECDSA private key at path. It may be a key made
+// by cosign generate-key-pair, encrypted with password, or an unencrypted
+// PKCS #8 or SEC 1 PEM key.
+func loadSigningKey(path string, password []byte) (*ecdsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, fmt.Errorf("%s contains no PEM block", path)
+	}
+	var key interface{}
+	switch p.Type {
+	case cosign.CosignPrivateKeyPemType:
+		der, err := encrypted.Decrypt(p.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting key: %w", err)
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key: %w", err)
+		}
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key: %w", err)
+		}
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", p.Type)
+	}
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is a %T, the write probers need an ECDSA key", key)
+	}
+	if err := cryptoutils.ValidatePubKey(&priv.PublicKey); err != nil {
+		return nil, fmt.Errorf("validating key: %w", err)
+	}
+	return priv, nil
+}
+
+// signingKey returns the key the write probers sign with: the one from
+// --signing-key if it is set, and a new ephemeral key otherwise.
+func signingKey() (*ecdsa.PrivateKey, error) {
+	if fixedSigningKey != nil {
+		return fixedSigningKey, nil
+	}
+	return cosign.GeneratePrivateKey()
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// metricsSink is a metrics backend that request latencies and probe results
+// are mirrored to, alongside Prometheus.
+type metricsSink interface {
+	// observeLatency records the latency in milliseconds of a single
+	// request.
+	observeLatency(host, endpoint string, statusCode int, latency int64)
+	// countResult counts a single probe by result, and by reason if it
+	// failed.
+	countResult(host, endpoint, result, reason string)
+}
+
+// sinks are the metrics sinks enabled in addition to Prometheus, such as
+// the StatsD sink for --statsd-addr.
+var sinks []metricsSink
+
+// statsdSink sends metrics to a StatsD server over UDP, with DogStatsD tags
+// in place of Prometheus labels. Sends are best effort, as is usual for
+// StatsD.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+// newStatsdSink returns a sink that sends metrics to the StatsD server at
+// addr, with each metric name prefixed by prefix.
+func newStatsdSink(addr, prefix string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing StatsD server %s: %w", addr, err)
+	}
+	return &statsdSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *statsdSink) observeLatency(host, endpoint string, statusCode int, latency int64) {
+	s.send("api_endpoint_latency", fmt.Sprintf("%d|ms", latency),
+		hostLabel, host, endpointLabel, endpoint, statusCodeLabel, fmt.Sprintf("%d", statusCode))
+}
+
+func (s *statsdSink) countResult(host, endpoint, result, reason string) {
+	tags := []string{hostLabel, host, endpointLabel, endpoint, resultLabel, result}
+	if reason != "" {
+		tags = append(tags, reasonLabel, reason)
+	}
+	s.send("requests", "1|c", tags...)
+}
+
+// send sends a single metric, tagged with the given name and value pairs.
+func (s *statsdSink) send(name, value string, tags ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sprober.%s:%s|#", s.prefix, name, value)
+	for i := 0; i+1 < len(tags); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s:%s", tags[i], statsdTagReplacer.Replace(tags[i+1]))
+	}
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		logger.Debugw("sending metric to StatsD", "error", err)
+	}
+}
+
+// statsdTagReplacer replaces the characters that delimit DogStatsD tags when
+// they appear in a tag value.
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// statsdPrefix returns the prefix for StatsD metric names from the
+// namespace and subsystem, such as "sigstore.prod." for --metric-namespace
+// sigstore and --metric-subsystem prod.
+func statsdPrefix(namespace, subsystem string) string {
+	var prefix string
+	for _, p := range []string{namespace, subsystem} {
+		if p != "" {
+			prefix += p + "."
+		}
+	}
+	return prefix
+}
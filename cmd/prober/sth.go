@@ -0,0 +1,189 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+const (
+	rekorPublicKeyEndpoint = "/api/v1/log/publicKey"
+	rekorSTHEndpointLabel  = rekorLogInfoEndpoint + " (sth)"
+)
+
+// treeHeads remembers the last tree size seen for each Rekor host and when
+// it last changed, to tell whether the log is advancing.
+var treeHeads = struct {
+	sync.Mutex
+	size    map[string]int64
+	changed map[string]time.Time
+}{
+	size:    map[string]int64{},
+	changed: map[string]time.Time{},
+}
+
+// rekorSTHProbe fetches the signed tree head of the Rekor log at host,
+// verifies its signature against the log's public key, and records the tree
+// size and how long it has been since the tree last grew.
+func rekorSTHProbe(ctx context.Context, client *http.Client, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", rekorSTHEndpointLabel)
+
+	var logInfo models.LogInfo
+	admitted, err := admitRequest(withConnTrace(ctx, host))
+	if err != nil {
+		return fmt.Errorf("fetching log info: %w", err)
+	}
+	s := time.Now()
+	err = getJSON(admitted, client, host+rekorLogInfoEndpoint, &logInfo)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, rekorSTHEndpointLabel, latency, err)
+	if err != nil {
+		return fmt.Errorf("fetching log info: %w", err)
+	}
+	if logInfo.TreeSize == nil || logInfo.RootHash == nil || logInfo.SignedTreeHead == nil || logInfo.TreeID == nil {
+		return fmt.Errorf("incomplete log info")
+	}
+
+	labels := prometheus.Labels{hostLabel: host}
+	rekorTreeSizeGauge.With(labels).Set(float64(*logInfo.TreeSize))
+	rekorSTHAgeGauge.With(labels).Set(sthAge(host, *logInfo.TreeSize, time.Now()).Seconds())
+	if rate, ok := entriesRate(host, *logInfo.TreeID, *logInfo.TreeSize, time.Now()); ok {
+		rekorEntriesRateGauge.With(labels).Set(rate)
+	}
+
+	err = verifyRekorSTH(ctx, client, host, logInfo)
+	recordVerificationResult(host, rekorSTHEndpointLabel, err)
+	if err != nil {
+		rekorSTHSignatureFailuresCounter.With(labels).Inc()
+		return &verificationError{err: err}
+	}
+	return nil
+}
+
+// sthAge records size as the current tree size of host and returns how long
+// ago the tree size last changed.
+func sthAge(host string, size int64, now time.Time) time.Duration {
+	treeHeads.Lock()
+	defer treeHeads.Unlock()
+	if last, ok := treeHeads.size[host]; !ok || last != size {
+		treeHeads.size[host] = size
+		treeHeads.changed[host] = now
+	}
+	return now.Sub(treeHeads.changed[host])
+}
+
+// treeSizeSample is the tree size of a Rekor log at some time.
+type treeSizeSample struct {
+	time time.Time
+	size int64
+}
+
+// treeSizes holds up to --tree-size-samples recent tree sizes for each Rekor
+// host, oldest first, to derive the rate the log is growing at, and the ID
+// of the tree they were taken from.
+var treeSizes = struct {
+	sync.Mutex
+	samples map[string][]treeSizeSample
+	treeID  map[string]string
+}{
+	samples: map[string][]treeSizeSample{},
+	treeID:  map[string]string{},
+}
+
+// entriesRate records size as the tree size of host at now, and returns the
+// number of entries added per minute across the samples held, or false if
+// there are not yet enough samples to tell. If the tree ID changed, Rekor
+// rotated its shard and the samples start over. If the tree size of the same
+// tree went backwards the decrease is counted and logged, and the samples
+// start over too.
+func entriesRate(host, treeID string, size int64, now time.Time) (float64, bool) {
+	treeSizes.Lock()
+	defer treeSizes.Unlock()
+	samples := treeSizes.samples[host]
+	if last, ok := treeSizes.treeID[host]; ok && last != treeID {
+		logger.Infow("Rekor tree ID changed, resetting the entries rate", "host", host, "previous", last, "treeID", treeID)
+		rekorEntriesRateGauge.Delete(prometheus.Labels{hostLabel: host})
+		samples = samples[:0]
+	}
+	treeSizes.treeID[host] = treeID
+	if n := len(samples); n > 0 && size < samples[n-1].size {
+		logger.Errorw("Rekor tree size went backwards", "host", host, "previous", samples[n-1].size, "size", size)
+		rekorTreeSizeDecreasesCounter.With(prometheus.Labels{hostLabel: host}).Inc()
+		rekorEntriesRateGauge.Delete(prometheus.Labels{hostLabel: host})
+		samples = samples[:0]
+	}
+	if len(samples) >= treeSizeSamples {
+		// Drop the oldest sample, reusing the slice so that memory stays
+		// bounded.
+		copy(samples, samples[len(samples)-treeSizeSamples+1:])
+		samples = samples[:treeSizeSamples-1]
+	}
+	samples = append(samples, treeSizeSample{time: now, size: size})
+	treeSizes.samples[host] = samples
+
+	oldest := samples[0]
+	elapsed := now.Sub(oldest.time)
+	if len(samples) < 2 || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(size-oldest.size) / elapsed.Minutes(), true
+}
+
+// verifyRekorSTH verifies the signature on the signed tree head in logInfo
+// against the public key of the log at host, and checks that it commits to
+// the tree size and root hash that were reported alongside it.
+func verifyRekorSTH(ctx context.Context, client *http.Client, host string, logInfo models.LogInfo) error {
+	b, err := getBody(ctx, client, host+rekorPublicKeyEndpoint)
+	if err != nil {
+		return fmt.Errorf("fetching public key: %w", err)
+	}
+	pub, err := cryptoutils.UnmarshalPEMToPublicKey(b)
+	if err != nil {
+		return fmt.Errorf("parsing public key: %w", err)
+	}
+	verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("loading public key: %w", err)
+	}
+
+	var sth util.SignedCheckpoint
+	if err := sth.UnmarshalText([]byte(*logInfo.SignedTreeHead)); err != nil {
+		return fmt.Errorf("parsing signed tree head: %w", err)
+	}
+	if !sth.Verify(verifier) {
+		return fmt.Errorf("signed tree head signature is invalid")
+	}
+	root, err := hex.DecodeString(*logInfo.RootHash)
+	if err != nil {
+		return fmt.Errorf("decoding root hash: %w", err)
+	}
+	if sth.Size != uint64(*logInfo.TreeSize) || !bytes.Equal(sth.Hash, root) {
+		return fmt.Errorf("signed tree head does not match the reported tree size %d and root hash %s", *logInfo.TreeSize, *logInfo.RootHash)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRekorSTHProbeExportsStatusCode(t *testing.T) {
+	srv := statusServer(t, http.StatusServiceUnavailable)
+
+	err := rekorSTHProbe(context.Background(), newTestClient(t), srv.URL)
+	var statusErr *statusCodeError
+	if !errors.As(err, &statusErr) || statusErr.statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("rekorSTHProbe() = %v, want a statusCodeError for 503", err)
+	}
+	labels := prometheus.Labels{
+		endpointLabel:   rekorSTHEndpointLabel,
+		hostLabel:       srv.URL,
+		statusCodeLabel: strconv.Itoa(http.StatusServiceUnavailable),
+	}
+	if got := histogramCount(t, requestDurationHistogram, labels); got != 1 {
+		t.Errorf("prober_request_duration_seconds count for 503 = %d, want 1", got)
+	}
+}
+
+func TestEntriesRate(t *testing.T) {
+	host := "https://rekor.example.com"
+	start := time.Now()
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	defer func(n int) { treeSizeSamples = n }(treeSizeSamples)
+	treeSizeSamples = 10
+	rekorTreeSizeDecreasesCounter.Reset()
+
+	if _, ok := entriesRate(host, "1", 100, at(0)); ok {
+		t.Fatal("entriesRate() with one sample reported a rate")
+	}
+	if rate, ok := entriesRate(host, "1", 160, at(2)); !ok || rate != 30 {
+		t.Fatalf("entriesRate() = %v, %v, want 30, true", rate, ok)
+	}
+
+	// A new shard starts out smaller, which is not a decrease.
+	if _, ok := entriesRate(host, "2", 10, at(3)); ok {
+		t.Error("entriesRate() reported a rate across a tree ID change")
+	}
+	if rate, ok := entriesRate(host, "2", 40, at(4)); !ok || rate != 30 {
+		t.Errorf("entriesRate() after rotation = %v, %v, want 30, true", rate, ok)
+	}
+	if n := testutil.CollectAndCount(rekorTreeSizeDecreasesCounter); n != 0 {
+		t.Errorf("prober_rekor_tree_size_decreases_total has %d series, want 0", n)
+	}
+
+	// The same tree shrinking is still a decrease.
+	entriesRate(host, "2", 20, at(5))
+	if got := testutil.ToFloat64(rekorTreeSizeDecreasesCounter.WithLabelValues(host)); got != 1 {
+		t.Errorf("prober_rekor_tree_size_decreases_total = %v, want 1", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/scaffolding/pkg/oidctoken"
+)
+
+const (
+	// tokenRefreshWindow is how long before it expires a cached token is
+	// replaced.
+	tokenRefreshWindow = 5 * time.Minute
+	// authTokenReloadInterval is how often --auth-token-file is re-read.
+	authTokenReloadInterval = time.Minute
+)
+
+// tokenCache holds the last token minted by the ambient providers so it can
+// be reused across write prober cycles until it is close to expiring.
+type tokenCache struct {
+	sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+var providerTokens tokenCache
+
+// get returns the cached token, or mints a new one with fetch if there is
+// none or it expires within tokenRefreshWindow. Tokens whose expiry cannot
+// be read are not cached.
+func (c *tokenCache) get(ctx context.Context, fetch func(context.Context) (string, error)) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.token != "" && time.Until(c.expiry) > tokenRefreshWindow {
+		return c.token, nil
+	}
+
+	tok, err := fetch(ctx)
+	recordTokenRefresh(err)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = tok, tokenExpiry(tok)
+	return tok, nil
+}
+
+// tokenExpiry returns the expiry of the JWT tok, or the zero time if it
+// cannot be read. The token is not verified, that is up to Fulcio.
+func tokenExpiry(tok string) time.Time {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+func recordTokenRefresh(err error) {
+	tokenRefreshCounter.With(prometheus.Labels{resultLabel: resultOf(err)}).Inc()
+}
+
+// fulcioIdentityToken returns the OIDC token the Fulcio write prober
+// authenticates with. --identity-token and --identity-token-file take
+// precedence over the ambient providers. The file is read on every call so
+// that rotated tokens are picked up, while tokens from the providers are
+// cached until they are about to expire.
+func fulcioIdentityToken(ctx context.Context) (string, error) {
+	switch {
+	case identityToken != "":
+		return identityToken, nil
+	case identityTokenFile != "":
+		b, err := os.ReadFile(identityTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading --identity-token-file: %w", err)
+		}
+		tok := strings.TrimSpace(string(b))
+		if tok == "" {
+			return "", fmt.Errorf("--identity-token-file %s is empty", identityTokenFile)
+		}
+		return tok, nil
+	case oidctoken.Enabled(ctx, ""):
+		return providerTokens.get(ctx, func(ctx context.Context) (string, error) {
+			return oidctoken.Get(ctx, "", oidctoken.DefaultAudience)
+		})
+	}
+	return "", fmt.Errorf("no identity token for fulcio: set --identity-token or --identity-token-file, or run where an ambient OIDC provider is enabled")
+}
+
+// fileToken is a token read from a file, re-read every
+// authTokenReloadInterval so that rotated tokens are picked up.
+type fileToken struct {
+	sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+var authTokens fileToken
+
+func (f *fileToken) get(path string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.token != "" && time.Since(f.readAt) < authTokenReloadInterval {
+		return f.token, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
+	}
+	tok := strings.TrimSpace(string(b))
+	if tok == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	f.token, f.readAt = tok, time.Now()
+	return tok, nil
+}
+
+// probeAuthToken returns the bearer token to send with read probes from
+// --auth-token or --auth-token-file, or "" if neither is set.
+func probeAuthToken() (string, error) {
+	switch {
+	case authToken != "":
+		return authToken, nil
+	case authTokenFile != "":
+		return authTokens.get(authTokenFile)
+	}
+	return "", nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// withConnTrace returns a copy of ctx that records how long DNS lookups,
+// TCP connects and TLS handshakes take for requests made to host. Reused
+// connections record nothing.
+func withConnTrace(ctx context.Context, host string) context.Context {
+	var (
+		mu           sync.Mutex
+		dnsStart     time.Time
+		tlsStart     time.Time
+		connectStart = map[string]time.Time{}
+	)
+	labels := prometheus.Labels{hostLabel: host}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if info.Err == nil {
+				dnsLatencyHistogram.With(labels).Observe(time.Since(dnsStart).Seconds())
+			}
+		},
+		// Several connections may be attempted in parallel, e.g. for IPv4
+		// and IPv6, so track each address separately.
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			connectStart[network+addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if start, ok := connectStart[network+addr]; ok && err == nil {
+				connectLatencyHistogram.With(labels).Observe(time.Since(start).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				tlsHandshakeLatencyHistogram.With(labels).Observe(time.Since(tlsStart).Seconds())
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// withFirstByteTrace returns a copy of ctx that records how long after start
+// the first byte of the response to a request to endpoint on host arrives.
+// Only the first response is recorded, so that of a hedged request is when
+// either copy of it first responded.
+func withFirstByteTrace(ctx context.Context, host, endpoint string, start time.Time) context.Context {
+	var once sync.Once
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			once.Do(func() {
+				ttfbHistogram.With(prometheus.Labels{endpointLabel: endpoint, hostLabel: host}).Observe(time.Since(start).Seconds())
+			})
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
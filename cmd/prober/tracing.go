@@ -0,0 +1,108 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/sigstore/scaffolding/cmd/prober"
+
+// tracerProvider exports spans to --otlp-endpoint. It is nil when tracing
+// is disabled, in which case the global no-op provider is used.
+var tracerProvider *sdktrace.TracerProvider
+
+// setupTracing installs a tracer provider that exports spans to
+// --otlp-endpoint over gRPC, and propagates trace context to probed hosts.
+// It does nothing if --otlp-endpoint is unset.
+func setupTracing(ctx context.Context) error {
+	if otlpEndpoint == "" {
+		return nil
+	}
+	exporter, err := newOTLPExporter(ctx, otlpEndpoint, otlpInsecure)
+	if err != nil {
+		return fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("prober"))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return nil
+}
+
+// shutdownTracing flushes any spans that have not been exported yet.
+func shutdownTracing(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logger.Errorw("shutting down tracing", "error", err)
+	}
+}
+
+// startProbeSpan starts the span covering a single probe, named after the
+// endpoint it probes.
+func startProbeSpan(ctx context.Context, host, endpoint string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, endpoint,
+		trace.WithAttributes(semconv.HTTPHostKey.String(host)))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingTransport wraps each request in a client span and propagates its
+// trace context to the server in the request headers.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(tracerName).Start(req.Context(), "HTTP "+req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(req.URL.String()),
+		))
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	endSpan(span, err)
+	return resp, err
+}
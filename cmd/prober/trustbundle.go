@@ -0,0 +1,141 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+const fulcioTrustBundleEndpointLabel = fulcioRootEndpoint + " (trust bundle)"
+
+// trustBundles remembers the fingerprint of the trust bundle last seen for
+// each Fulcio host, to tell when it rotates.
+var trustBundles = struct {
+	sync.Mutex
+	fingerprint map[string]string
+}{fingerprint: map[string]string{}}
+
+// fulcioTrustBundleProbe fetches the trust bundle of the Fulcio instance at
+// host and checks it with checkTrustBundle. It only runs for hosts whose
+// trust bundle no read probe already fetches, see returnsTrustBundle.
+func fulcioTrustBundleProbe(ctx context.Context, client *http.Client, host string) error {
+	logger.Debugw("observing", "host", host, "endpoint", fulcioTrustBundleEndpointLabel)
+
+	admitted, err := admitRequest(withConnTrace(ctx, host))
+	if err != nil {
+		return fmt.Errorf("fetching trust bundle: %w", err)
+	}
+	s := time.Now()
+	b, err := getBody(admitted, client, host+fulcioRootEndpoint)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, fulcioTrustBundleEndpointLabel, latency, err)
+	if err != nil {
+		return fmt.Errorf("fetching trust bundle: %w", err)
+	}
+	return checkTrustBundle(host, b)
+}
+
+// returnsTrustBundle reports whether r reads the trust bundle of a probed
+// Fulcio instance, so that rotations can be tracked from its response
+// rather than by fetching the bundle a second time.
+func returnsTrustBundle(r ReadProberCheck) bool {
+	if r.Method != GET || r.Endpoint != fulcioRootEndpoint {
+		return false
+	}
+	for _, host := range fulcioURLs() {
+		if r.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTrustBundle records the fingerprint of b, the trust bundle of the
+// Fulcio instance at host, counting and logging every change of it after
+// the first cycle. If --fulcio-trust-bundle-fingerprint is set, it fails
+// unless the fingerprint is one of the pinned ones.
+func checkTrustBundle(host string, b []byte) error {
+	fingerprint, err := trustBundleFingerprint(b)
+	if err != nil {
+		return err
+	}
+	recordTrustBundle(host, fingerprint)
+
+	if fulcioTrustBundleFingerprint != "" {
+		err := checkPinnedFingerprint(fingerprint)
+		recordVerificationResult(host, fulcioTrustBundleEndpointLabel, err)
+		if err != nil {
+			return &verificationError{err: err}
+		}
+	}
+	return nil
+}
+
+// trustBundleFingerprint returns the hex SHA-256 of the DER of every
+// certificate in the PEM bundle b, in order, so that changes to the PEM
+// encoding alone do not change it.
+func trustBundleFingerprint(b []byte) (string, error) {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(b)
+	if err != nil {
+		return "", fmt.Errorf("parsing trust bundle: %w", err)
+	}
+	if len(certs) == 0 {
+		return "", fmt.Errorf("trust bundle has no certificates")
+	}
+	h := sha256.New()
+	for _, c := range certs {
+		h.Write(c.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordTrustBundle records fingerprint as the current trust bundle of
+// host, replacing the series for the previous one.
+func recordTrustBundle(host, fingerprint string) {
+	trustBundles.Lock()
+	defer trustBundles.Unlock()
+	prev, ok := trustBundles.fingerprint[host]
+	if ok && prev == fingerprint {
+		return
+	}
+	if ok {
+		logger.Warnw("Fulcio trust bundle changed", "host", host, "previous", prev, "fingerprint", fingerprint)
+		fulcioTrustBundleChangedCounter.With(prometheus.Labels{hostLabel: host}).Inc()
+		fulcioTrustBundleInfoGauge.Delete(prometheus.Labels{hostLabel: host, fingerprintLabel: prev})
+	}
+	trustBundles.fingerprint[host] = fingerprint
+	fulcioTrustBundleInfoGauge.With(prometheus.Labels{hostLabel: host, fingerprintLabel: fingerprint}).Set(1)
+}
+
+// checkPinnedFingerprint checks that fingerprint is one of those given in
+// --fulcio-trust-bundle-fingerprint.
+func checkPinnedFingerprint(fingerprint string) error {
+	for _, f := range strings.Split(fulcioTrustBundleFingerprint, ",") {
+		if strings.EqualFold(strings.TrimSpace(f), fingerprint) {
+			return nil
+		}
+	}
+	return fmt.Errorf("trust bundle fingerprint %s does not match --fulcio-trust-bundle-fingerprint", fingerprint)
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTrustBundleFromReadProbe(t *testing.T) {
+	var fetches int32
+	bundle := newTestTSA(t).chainPEM
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == fulcioRootEndpoint {
+			atomic.AddInt32(&fetches, 1)
+		}
+		w.Write(bundle)
+	}))
+	defer srv.Close()
+	defer func(url string, enable bool) { fulcioURL, enableFulcio = url, enable }(fulcioURL, enableFulcio)
+	fulcioURL, enableFulcio = srv.URL, true
+	client := newTestClient(t)
+
+	hasTrustBundleJob := func(checks []ReadProberCheck) bool {
+		for _, j := range probeJobs(checks, client) {
+			if j.host == srv.URL && j.endpoint == fulcioTrustBundleEndpointLabel {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasTrustBundleJob(nil) {
+		t.Error("probeJobs() without a rootCert check has no trust bundle probe")
+	}
+	rootCert := FulcioEndpoints[0]
+	rootCert.Host = srv.URL
+	if hasTrustBundleJob([]ReadProberCheck{rootCert}) {
+		t.Error("probeJobs() with a rootCert check also has a trust bundle probe")
+	}
+
+	fulcioTrustBundleInfoGauge.Reset()
+	if err := observeRequest(context.Background(), client, srv.URL, rootCert); err != nil {
+		t.Fatalf("observeRequest() = %v", err)
+	}
+	if n := testutil.CollectAndCount(fulcioTrustBundleInfoGauge); n != 1 {
+		t.Errorf("prober_fulcio_trust_bundle_info has %d series, want 1", n)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("the trust bundle was fetched %d times, want 1", n)
+	}
+}
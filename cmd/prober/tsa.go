@@ -0,0 +1,217 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+	"github.com/pkg/errors"
+)
+
+const (
+	tsaTimestampEndpoint = "/api/v1/timestamp"
+	tsaCertChainEndpoint = "/api/v1/timestamp/certchain"
+)
+
+// tsaCertChain is the certificate chain loaded from --tsa-cert-chain, leaf
+// first. If it is empty, the chain the TSA serves is used instead.
+var tsaCertChain []*x509.Certificate
+
+// servedCertChains holds the certificate chain each TSA last served to the
+// certchain read probe, so that the timestamp probe need not fetch it again.
+var servedCertChains = struct {
+	sync.Mutex
+	chain map[string][]*x509.Certificate
+}{chain: map[string][]*x509.Certificate{}}
+
+// tsaWriteEndpoint tests the write path for the timestamp authority by
+// requesting an RFC 3161 timestamp from "/api/v1/timestamp", and checking
+// that the returned token covers the data we asked to be timestamped and is
+// signed by a certificate that chains up to the TSA's certificate chain.
+// The chain is --tsa-cert-chain if set, and otherwise the one the TSA
+// serves at "/api/v1/timestamp/certchain", as last read by the certchain
+// read probe or else fetched here.
+func tsaWriteEndpoint(ctx context.Context, client *http.Client, tsaURL string) error {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return err
+	}
+	b, err := timestamp.CreateRequest(bytes.NewReader(data), &timestamp.RequestOptions{
+		Hash:         crypto.SHA256,
+		Certificates: true,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshaling timestamp request")
+	}
+
+	endpoint := tsaTimestampEndpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tsaURL+endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+
+	logger.Debugw("observing", "host", tsaURL, "endpoint", endpoint)
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return errors.Wrap(err, "requesting timestamp")
+	}
+	req = req.WithContext(admitted)
+	t := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(t).Milliseconds()
+	if err != nil {
+		return errors.Wrap(err, "requesting timestamp")
+	}
+	defer drainBody(resp.Body)
+	exportDataToPrometheus(ctx, tsaURL, endpoint, resp.StatusCode, latency)
+	logRequest(tsaURL, endpoint, resp.StatusCode, latency)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return errors.Wrap(&statusCodeError{statusCode: resp.StatusCode}, "requesting timestamp")
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(bodyReadError(err), "reading timestamp response")
+	}
+	chain := tsaCertChain
+	if len(chain) == 0 {
+		chain = servedCertChain(tsaURL)
+	}
+	if len(chain) == 0 {
+		// Failing to fetch the chain is not a verification failure.
+		if chain, err = fetchTSACertChain(ctx, client, tsaURL); err != nil {
+			return err
+		}
+	}
+	err = verifyTimestampResponse(body, digest[:], nonce, chain)
+	recordVerificationResult(tsaURL, endpoint, err)
+	if err != nil {
+		return &verificationError{err: err}
+	}
+	return nil
+}
+
+// fetchTSACertChain fetches the certificate chain of the TSA at tsaURL,
+// leaf first.
+func fetchTSACertChain(ctx context.Context, client *http.Client, tsaURL string) ([]*x509.Certificate, error) {
+	b, err := getBody(ctx, client, tsaURL+tsaCertChainEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("fetching certificate chain: %w", err)
+	}
+	return parseCertChain(b)
+}
+
+// returnsTSACertChain reports whether r reads the certificate chain of a
+// probed TSA, so that the timestamp probe can verify against it.
+func returnsTSACertChain(r ReadProberCheck) bool {
+	if r.Method != GET || r.Endpoint != tsaCertChainEndpoint {
+		return false
+	}
+	for _, host := range splitURLs(tsaURL) {
+		if r.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// recordServedCertChain parses b, the certificate chain served by the TSA
+// at host, and keeps it for the timestamp probe of host.
+func recordServedCertChain(host string, b []byte) error {
+	chain, err := parseCertChain(b)
+	if err != nil {
+		return err
+	}
+	servedCertChains.Lock()
+	defer servedCertChains.Unlock()
+	servedCertChains.chain[host] = chain
+	return nil
+}
+
+// servedCertChain returns the certificate chain the TSA at host last served
+// to the certchain read probe, or nil if it has not been read yet.
+func servedCertChain(host string) []*x509.Certificate {
+	servedCertChains.Lock()
+	defer servedCertChains.Unlock()
+	return servedCertChains.chain[host]
+}
+
+// loadTSACertChain reads the PEM certificate chain for --tsa-cert-chain
+// from path.
+func loadTSACertChain(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertChain(b)
+}
+
+// verifyTimestampResponse checks that the timestamp was granted, that the
+// token is for digest and echoes nonce, and that it is signed by a
+// certificate that chains up to the last certificate in chain.
+func verifyTimestampResponse(body, digest []byte, nonce *big.Int, chain []*x509.Certificate) error {
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return fmt.Errorf("parsing timestamp response: %w", err)
+	}
+	if err := verifyTimestampSignature(ts.RawToken, chain); err != nil {
+		return err
+	}
+	if ts.HashAlgorithm != crypto.SHA256 || !bytes.Equal(ts.HashedMessage, digest) {
+		return fmt.Errorf("timestamp token is for a different message")
+	}
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return fmt.Errorf("timestamp token nonce does not match the request")
+	}
+	return nil
+}
+
+// verifyTimestampSignature verifies the CMS signature on the timestamp
+// token, and that the signing certificate chains up to the root at the end
+// of chain through the certificates in the token and chain.
+func verifyTimestampSignature(token []byte, chain []*x509.Certificate) error {
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return fmt.Errorf("parsing timestamp token: %w", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(chain[len(chain)-1])
+	p7.Certificates = append(p7.Certificates, chain...)
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return fmt.Errorf("verifying timestamp token signature: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+// testTSA is a timestamp authority with a timestamping certificate issued
+// by its own root.
+type testTSA struct {
+	key      crypto.Signer
+	leaf     *x509.Certificate
+	chainPEM []byte
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	t.Helper()
+	newCert := func(tmpl, parent *x509.Certificate, pub, priv interface{}) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test TSA root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := newCert(rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	leaf := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, root, leafKey.Public(), rootKey)
+	chainPEM, err := cryptoutils.MarshalCertificatesToPEM([]*x509.Certificate{leaf, root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTSA{key: leafKey, leaf: leaf, chainPEM: chainPEM}
+}
+
+// ServeHTTP serves the certificate chain, and timestamps requests the way
+// the sigstore TSA does.
+func (c *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == tsaCertChainEndpoint {
+		w.Write(c.chainPEM)
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	req, err := timestamp.ParseRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ts := timestamp.Timestamp{
+		HashAlgorithm:     req.HashAlgorithm,
+		HashedMessage:     req.HashedMessage,
+		Time:              time.Now(),
+		Nonce:             req.Nonce,
+		Policy:            asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+		AddTSACertificate: req.Certificates,
+	}
+	resp, err := ts.CreateResponse(c.leaf, c.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func TestTSAWriteEndpoint(t *testing.T) {
+	client := newTestClient(t)
+	tsa := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	defer func(chain []*x509.Certificate) { tsaCertChain = chain }(tsaCertChain)
+
+	t.Run("served chain", func(t *testing.T) {
+		tsaCertChain = nil
+		if err := tsaWriteEndpoint(context.Background(), client, srv.URL); err != nil {
+			t.Errorf("tsaWriteEndpoint() = %v, want nil", err)
+		}
+	})
+
+	t.Run("pinned chain", func(t *testing.T) {
+		chain, err := parseCertChain(tsa.chainPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tsaCertChain = chain
+		if err := tsaWriteEndpoint(context.Background(), client, srv.URL); err != nil {
+			t.Errorf("tsaWriteEndpoint() = %v, want nil", err)
+		}
+	})
+
+	t.Run("chain from the read probe", func(t *testing.T) {
+		var fetches int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == tsaCertChainEndpoint {
+				atomic.AddInt32(&fetches, 1)
+			}
+			tsa.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		defer func(url string) { tsaURL = url }(tsaURL)
+		tsaURL = srv.URL
+		tsaCertChain = nil
+		certChain := TSAEndpoints[0]
+		certChain.Host = srv.URL
+		if err := observeRequest(context.Background(), client, srv.URL, certChain); err != nil {
+			t.Fatalf("observeRequest() = %v", err)
+		}
+		if err := tsaWriteEndpoint(context.Background(), client, srv.URL); err != nil {
+			t.Errorf("tsaWriteEndpoint() = %v, want nil", err)
+		}
+		if n := atomic.LoadInt32(&fetches); n != 1 {
+			t.Errorf("the certificate chain was fetched %d times, want 1", n)
+		}
+	})
+
+	t.Run("signed by another TSA", func(t *testing.T) {
+		chain, err := parseCertChain(newTestTSA(t).chainPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tsaCertChain = chain
+		err = tsaWriteEndpoint(context.Background(), client, srv.URL)
+		var verifyErr *verificationError
+		if !errors.As(err, &verifyErr) {
+			t.Errorf("tsaWriteEndpoint() = %v, want a verificationError", err)
+		}
+	})
+}
@@ -0,0 +1,273 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+	"github.com/theupdateframework/go-tuf/verify"
+)
+
+// tufRoles are the top-level TUF roles whose metadata is probed. The root
+// role is not included, it is only updated when keys are rotated.
+var tufRoles = []string{"timestamp", "snapshot", "targets"}
+
+// tufMetadataEndpoint returns the path of the metadata for role.
+func tufMetadataEndpoint(role string) string {
+	return "/" + role + ".json"
+}
+
+// tufMetadataProbe fetches the metadata for role from the TUF repository at
+// host and records when it expires. The probe fails if the metadata expires
+// within --tuf-expiry-threshold. If --trust-root is set, the signatures on
+// the timestamp metadata are verified against the keys in that root.
+func tufMetadataProbe(ctx context.Context, client *http.Client, host, role string) error {
+	endpoint := tufMetadataEndpoint(role)
+	logger.Debugw("observing", "host", host, "endpoint", endpoint)
+
+	req, err := http.NewRequestWithContext(withConnTrace(ctx, host), http.MethodGet, host+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(admitted)
+	s := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(s).Milliseconds()
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp.Body)
+
+	logRequest(host, endpoint, resp.StatusCode, latency)
+	exportDataToPrometheus(ctx, host, endpoint, resp.StatusCode, latency)
+	recordTLSCertExpiry(host, resp.TLS)
+	if resp.StatusCode != http.StatusOK {
+		return &statusCodeError{statusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return bodyReadError(err)
+	}
+	var signed data.Signed
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return fmt.Errorf("decoding %s metadata: %w", role, err)
+	}
+	// Every top-level role other than root has the same _type, version and
+	// expires fields, which is all that is needed here.
+	var meta struct {
+		Type    string    `json:"_type"`
+		Expires time.Time `json:"expires"`
+	}
+	if err := json.Unmarshal(signed.Signed, &meta); err != nil {
+		return fmt.Errorf("decoding %s metadata: %w", role, err)
+	}
+	if meta.Type != role {
+		return fmt.Errorf("expected %s metadata, got %q", role, meta.Type)
+	}
+
+	expiry := time.Until(meta.Expires)
+	tufExpiryGauge.With(prometheus.Labels{hostLabel: host, roleLabel: role}).Set(expiry.Seconds())
+
+	if trustedRoot != nil && role == "timestamp" {
+		err := verifyTUFSignatures(&signed, role)
+		recordVerificationResult(host, endpoint, err)
+		if err != nil {
+			return &verificationError{err: err}
+		}
+	}
+	if expiry < tufExpiryThreshold {
+		return fmt.Errorf("%s metadata expires at %s, within --tuf-expiry-threshold", role, meta.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// tufTargetEndpoint returns the path of target in a TUF repository, which
+// is how it is labelled even when consistent snapshots are in use.
+func tufTargetEndpoint(target string) string {
+	return "/targets/" + target
+}
+
+// tufTargetProbe downloads target from the TUF repository at host and checks
+// that its length and hashes match those in the targets metadata, as a
+// client bootstrapping trust from the repository would. If --trust-root is
+// set, the signatures on the targets metadata are verified first.
+func tufTargetProbe(ctx context.Context, client *http.Client, host, target string) error {
+	endpoint := tufTargetEndpoint(target)
+	logger.Debugw("observing", "host", host, "endpoint", endpoint)
+
+	b, err := getBody(withConnTrace(ctx, host), client, host+tufMetadataEndpoint("targets"))
+	if err != nil {
+		return fmt.Errorf("fetching targets metadata: %w", err)
+	}
+	var signed data.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return fmt.Errorf("decoding targets metadata: %w", err)
+	}
+	if trustedRoot != nil {
+		if err := verifyTUFSignatures(&signed, "targets"); err != nil {
+			recordTUFTarget(host, target, err)
+			return &verificationError{err: err}
+		}
+	}
+	var targets data.Targets
+	if err := json.Unmarshal(signed.Signed, &targets); err != nil {
+		return fmt.Errorf("decoding targets metadata: %w", err)
+	}
+	expected, ok := targets.Targets[target]
+	if !ok {
+		err := fmt.Errorf("target %s is not in the targets metadata", target)
+		recordTUFTarget(host, target, err)
+		return &verificationError{err: err}
+	}
+
+	consistent, err := consistentSnapshot(ctx, client, host)
+	if err != nil {
+		return err
+	}
+	path := endpoint
+	if consistent {
+		path = util.HashedPaths(endpoint, expected.Hashes)[0]
+	}
+	admitted, err := admitRequest(ctx)
+	if err != nil {
+		return fmt.Errorf("downloading target %s: %w", target, err)
+	}
+	s := time.Now()
+	body, err := getBody(admitted, client, host+path)
+	latency := time.Since(s).Milliseconds()
+	exportGetResult(ctx, host, endpoint, latency, err)
+	if err != nil {
+		return fmt.Errorf("downloading target %s: %w", target, err)
+	}
+
+	actual, err := util.GenerateTargetFileMeta(bytes.NewReader(body), expected.HashAlgorithms()...)
+	if err == nil {
+		err = util.TargetFileMetaEqual(actual, expected)
+	}
+	recordTUFTarget(host, target, err)
+	if err != nil {
+		return &verificationError{err: fmt.Errorf("target %s: %w", target, err)}
+	}
+	return nil
+}
+
+// consistentSnapshot reports whether the TUF repository at host uses
+// consistent snapshots, and so serves targets under their hashes. This is
+// read from the trusted root if --trust-root is set, and otherwise from the
+// repository's own root metadata.
+func consistentSnapshot(ctx context.Context, client *http.Client, host string) (bool, error) {
+	if trustedRoot != nil {
+		return trustedRoot.ConsistentSnapshot, nil
+	}
+	var signed data.Signed
+	if err := getJSON(ctx, client, host+"/root.json", &signed); err != nil {
+		return false, fmt.Errorf("fetching root metadata: %w", err)
+	}
+	var root data.Root
+	if err := json.Unmarshal(signed.Signed, &root); err != nil {
+		return false, fmt.Errorf("decoding root metadata: %w", err)
+	}
+	return root.ConsistentSnapshot, nil
+}
+
+func recordTUFTarget(host, target string, err error) {
+	tufTargetVerificationCounter.With(prometheus.Labels{hostLabel: host, targetLabel: target, resultLabel: resultOf(err)}).Inc()
+}
+
+// trustedRoot is the TUF root loaded from --trust-root at startup, or nil if
+// it is not set.
+var trustedRoot *data.Root
+
+// loadTrustRoot reads the TUF root metadata at path, and checks that it is
+// signed by a threshold of its own root keys and has not expired.
+func loadTrustRoot(path string) (*data.Root, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var signed data.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	var root data.Root
+	if err := json.Unmarshal(signed.Signed, &root); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if root.Type != "root" {
+		return nil, fmt.Errorf("%s is %q metadata, not root", path, root.Type)
+	}
+	db, err := tufRoleDB(&root, "root")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.VerifySignatures(&signed, "root"); err != nil {
+		return nil, fmt.Errorf("verifying %s signatures: %w", path, err)
+	}
+	if time.Now().After(root.Expires) {
+		return nil, fmt.Errorf("%s expired at %s", path, root.Expires.Format(time.RFC3339))
+	}
+	return &root, nil
+}
+
+// verifyTUFSignatures verifies that signed carries a threshold of valid
+// signatures for role from the keys in the trusted root.
+func verifyTUFSignatures(signed *data.Signed, role string) error {
+	db, err := tufRoleDB(trustedRoot, role)
+	if err != nil {
+		return err
+	}
+	if err := db.VerifySignatures(signed, role); err != nil {
+		return fmt.Errorf("verifying %s metadata signatures: %w", role, err)
+	}
+	return nil
+}
+
+// tufRoleDB returns a verification database holding role and its keys from
+// root.
+func tufRoleDB(root *data.Root, role string) (*verify.DB, error) {
+	r, ok := root.Roles[role]
+	if !ok {
+		return nil, fmt.Errorf("trust root has no %s role", role)
+	}
+	db := verify.NewDB()
+	for _, id := range r.KeyIDs {
+		k, ok := root.Keys[id]
+		if !ok {
+			continue
+		}
+		if err := db.AddKey(id, k); err != nil {
+			return nil, fmt.Errorf("adding %s key %s: %w", role, id, err)
+		}
+	}
+	if err := db.AddRole(role, r); err != nil {
+		return nil, fmt.Errorf("adding %s role: %w", role, err)
+	}
+	return db, nil
+}
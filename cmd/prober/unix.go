@@ -0,0 +1,96 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unixScheme = "unix"
+
+// unixTransport sends requests for unix:// URLs, such as
+// unix:///var/run/rekor.sock/api/v1/log, over the Unix domain socket at the
+// start of the path, and every other request to base. Each socket gets its
+// own transport so that connections to different sockets are never mixed
+// up in the pool.
+type unixTransport struct {
+	base http.RoundTripper
+
+	sync.Mutex
+	sockets map[string]*http.Transport
+}
+
+func (t *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != unixScheme {
+		return t.base.RoundTrip(req)
+	}
+	socket, path, err := splitSocketPath(req.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = "localhost"
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	req.Host = "localhost"
+	return t.transport(socket).RoundTrip(req)
+}
+
+func (t *unixTransport) transport(socket string) *http.Transport {
+	t.Lock()
+	defer t.Unlock()
+	if tr, ok := t.sockets[socket]; ok {
+		return tr
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, unixScheme, socket)
+		},
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+	if t.sockets == nil {
+		t.sockets = map[string]*http.Transport{}
+	}
+	t.sockets[socket] = tr
+	return tr
+}
+
+// splitSocketPath splits the path of a unix:// URL into the path of the
+// socket and the path to request over it, by finding the longest leading
+// part of the path that is a socket.
+func splitSocketPath(p string) (string, string, error) {
+	for i := len(p); i > 0; i = strings.LastIndex(p[:i], "/") {
+		fi, err := os.Stat(p[:i])
+		if err == nil && fi.Mode()&os.ModeSocket != 0 {
+			path := p[i:]
+			if path == "" {
+				path = "/"
+			}
+			return p[:i], path, nil
+		}
+	}
+	return "", "", fmt.Errorf("no Unix domain socket found in %s", p)
+}
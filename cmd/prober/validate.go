@@ -0,0 +1,91 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResponseValidation describes what the body of a successful response must
+// look like. Every field that is set must hold.
+type ResponseValidation struct {
+	// JSONPath is a dot-separated path of object keys and array indices,
+	// such as "inactiveShards.0.treeID", that must exist in the JSON body.
+	JSONPath string `json:"jsonPath,omitempty"`
+	// Regex is a regular expression the body must match.
+	Regex string `json:"regex,omitempty"`
+}
+
+// check reports why body does not satisfy v, or nil if it does.
+func (v *ResponseValidation) check(body []byte) error {
+	if v.JSONPath != "" {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("decoding response body: %w", err)
+		}
+		if !jsonPathExists(doc, v.JSONPath) {
+			return fmt.Errorf("response body has no %s", v.JSONPath)
+		}
+	}
+	if v.Regex != "" {
+		re, err := regexp.Compile(v.Regex)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("response body does not match %q", v.Regex)
+		}
+	}
+	return nil
+}
+
+// validate checks that v is well formed.
+func (v *ResponseValidation) validate() error {
+	if v.JSONPath == "" && v.Regex == "" {
+		return fmt.Errorf("validate must set jsonPath or regex")
+	}
+	if v.Regex != "" {
+		if _, err := regexp.Compile(v.Regex); err != nil {
+			return fmt.Errorf("invalid validate regex: %w", err)
+		}
+	}
+	return nil
+}
+
+func jsonPathExists(doc interface{}, path string) bool {
+	for _, key := range strings.Split(path, ".") {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[key]
+			if !ok {
+				return false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(d) {
+				return false
+			}
+			doc = d[i]
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+const (
+	rekorLogInfoEndpoint = "/api/v1/log"
+	rekorProofEndpoint   = "/api/v1/log/proof"
+	fulcioRootEndpoint   = "/api/v1/rootCert"
+)
+
+// returnsLogEntry reports whether r reads Rekor log entries, so that the
+// inclusion proofs in the response can be verified.
+func returnsLogEntry(r ReadProberCheck) bool {
+	return r.Method == GET && (r.Endpoint == rekorEntriesEndpoint || strings.HasPrefix(r.Endpoint, rekorEntriesEndpoint+"/"))
+}
+
+// verifyInclusion verifies the inclusion proof of every entry in body, a
+// Rekor log entry response, and checks that the proof is consistent with
+// the current signed tree head of the log at host.
+func verifyInclusion(ctx context.Context, client *http.Client, host string, body []byte) error {
+	var entries models.LogEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return fmt.Errorf("decoding log entry: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no log entries in response")
+	}
+	for uuid, e := range entries {
+		if err := verifyEntryInclusion(ctx, client, host, e); err != nil {
+			return fmt.Errorf("entry %s: %w", uuid, err)
+		}
+	}
+	return nil
+}
+
+func verifyEntryInclusion(ctx context.Context, client *http.Client, host string, e models.LogEntryAnon) error {
+	if e.Verification == nil || e.Verification.InclusionProof == nil {
+		return fmt.Errorf("missing inclusion proof")
+	}
+	p := e.Verification.InclusionProof
+	if p.LogIndex == nil || p.TreeSize == nil || p.RootHash == nil {
+		return fmt.Errorf("incomplete inclusion proof")
+	}
+	body, ok := e.Body.(string)
+	if !ok {
+		return fmt.Errorf("unexpected body type %T", e.Body)
+	}
+	leaf, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return fmt.Errorf("decoding body: %w", err)
+	}
+	hashes, err := decodeHashes(p.Hashes)
+	if err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(*p.RootHash)
+	if err != nil {
+		return fmt.Errorf("decoding root hash: %w", err)
+	}
+	leafHash := rfc6962.DefaultHasher.HashLeaf(leaf)
+	if err := proof.VerifyInclusion(rfc6962.DefaultHasher, uint64(*p.LogIndex), uint64(*p.TreeSize), leafHash, hashes, root); err != nil {
+		return fmt.Errorf("verifying inclusion proof: %w", err)
+	}
+
+	// The proof was computed against some tree head, make sure that tree
+	// head is consistent with the one the log is currently signing.
+	var logInfo models.LogInfo
+	if err := getJSON(ctx, client, host+rekorLogInfoEndpoint, &logInfo); err != nil {
+		return fmt.Errorf("fetching log info: %w", err)
+	}
+	if logInfo.TreeSize == nil || logInfo.RootHash == nil {
+		return fmt.Errorf("incomplete log info")
+	}
+	sthRoot, err := hex.DecodeString(*logInfo.RootHash)
+	if err != nil {
+		return fmt.Errorf("decoding signed tree head root hash: %w", err)
+	}
+	switch {
+	case *logInfo.TreeSize < *p.TreeSize:
+		return fmt.Errorf("inclusion proof tree size %d is larger than the signed tree head size %d", *p.TreeSize, *logInfo.TreeSize)
+	case *logInfo.TreeSize == *p.TreeSize:
+		if !strings.EqualFold(*logInfo.RootHash, *p.RootHash) {
+			return fmt.Errorf("inclusion proof root hash %s does not match signed tree head root hash %s", *p.RootHash, *logInfo.RootHash)
+		}
+		return nil
+	}
+	var cp models.ConsistencyProof
+	url := fmt.Sprintf("%s%s?firstSize=%d&lastSize=%d", host, rekorProofEndpoint, *p.TreeSize, *logInfo.TreeSize)
+	if err := getJSON(ctx, client, url, &cp); err != nil {
+		return fmt.Errorf("fetching consistency proof: %w", err)
+	}
+	cpHashes, err := decodeHashes(cp.Hashes)
+	if err != nil {
+		return err
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, uint64(*p.TreeSize), uint64(*logInfo.TreeSize), cpHashes, root, sthRoot); err != nil {
+		return fmt.Errorf("verifying consistency with signed tree head: %w", err)
+	}
+	return nil
+}
+
+func decodeHashes(hexHashes []string) ([][]byte, error) {
+	hashes := make([][]byte, 0, len(hexHashes))
+	for _, h := range hexHashes {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("decoding proof hash: %w", err)
+		}
+		hashes = append(hashes, b)
+	}
+	return hashes, nil
+}
+
+// parseCertChain parses a PEM certificate chain, leaf first.
+func parseCertChain(b []byte) ([]*x509.Certificate, error) {
+	chain, err := cryptoutils.UnmarshalCertificatesFromPEM(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate chain: %w", err)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates in chain")
+	}
+	return chain, nil
+}
+
+// verifyFulcioCert verifies that chain, the PEM certificate chain returned
+// by Fulcio, chains to Fulcio's root, is currently valid and was issued for
+// identity.
+func verifyFulcioCert(ctx context.Context, client *http.Client, host string, chain []byte, identity string) error {
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(chain)
+	if err != nil {
+		return fmt.Errorf("parsing certificate chain: %w", err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates in response")
+	}
+	leaf := certs[0]
+
+	roots, intermediates, err := fulcioRoots(ctx, client, host)
+	if err != nil {
+		return err
+	}
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return fmt.Errorf("verifying certificate chain: %w", err)
+	}
+
+	for _, email := range leaf.EmailAddresses {
+		if email == identity {
+			return nil
+		}
+	}
+	for _, uri := range leaf.URIs {
+		if uri.String() == identity {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate was not issued for %s", identity)
+}
+
+// fulcioRoots returns the trusted roots and intermediates for the Fulcio at
+// host. These are read from --fulcio-root-bundle if set, and fetched from
+// Fulcio otherwise.
+func fulcioRoots(ctx context.Context, client *http.Client, host string) (*x509.CertPool, *x509.CertPool, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if fulcioRootBundle != "" {
+		b, err = os.ReadFile(fulcioRootBundle)
+	} else {
+		b, err = getBody(ctx, client, host+fulcioRootEndpoint)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching Fulcio root: %w", err)
+	}
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing Fulcio root: %w", err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	return roots, intermediates, nil
+}
@@ -21,95 +21,267 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sigstore/cosign/pkg/cosign"
-	"github.com/sigstore/cosign/pkg/providers"
 	"github.com/sigstore/fulcio/pkg/api"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	hashedrekordv001 "github.com/sigstore/rekor/pkg/types/hashedrekord/v0.0.1"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/oauthflow"
 )
 
 const (
 	defaultOIDCIssuer   = "https://oauth2.sigstore.dev/auth"
 	defaultOIDCClientID = "sigstore"
+
+	fulcioSigningCertEndpoint = "/api/v1/signingCert"
+	rekorEntriesEndpoint      = "/api/v1/log/entries"
+	rekorWriteEndpointLabel   = rekorEntriesEndpoint + " (write)"
 )
 
 // fulcioWriteEndpoint tests the only write endpoint for Fulcio
 // which is "/api/v1/signingCert", which requests a cert from Fulcio
-func fulcioWriteEndpoint(ctx context.Context) error {
-	if !providers.Enabled(ctx) {
-		return fmt.Errorf("no auth provider for fulcio is enabled")
-	}
-	tok, err := providers.Provide(ctx, "sigstore")
+func fulcioWriteEndpoint(ctx context.Context, client *http.Client, fulcioURL string) error {
+	_, _, err := signingCert(ctx, client, fulcioURL, fulcioSigningCertEndpoint)
+	return err
+}
+
+// signingCert requests a certificate for the signing key from Fulcio and
+// verifies it, returning the certificate chain along with the key. The
+// request is recorded under the endpoint label.
+func signingCert(ctx context.Context, client *http.Client, fulcioURL, label string) ([]byte, *ecdsa.PrivateKey, error) {
+	tok, err := fulcioIdentityToken(ctx)
 	if err != nil {
-		return errors.Wrap(err, "getting provider")
+		return nil, nil, err
 	}
-	b, err := certificateRequest(ctx, tok)
+	b, identity, priv, err := certificateRequest(ctx, tok)
 	if err != nil {
-		return errors.Wrap(err, "certificate response")
+		return nil, nil, errors.Wrap(err, "certificate response")
 	}
 
 	// Construct the API endpoint for this handler
-	endpoint := "/api/v1/signingCert"
-	hostPath := fulcioURL + endpoint
+	hostPath := fulcioURL + fulcioSigningCertEndpoint
 
-	req, err := http.NewRequest(http.MethodPost, hostPath, bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hostPath, bytes.NewBuffer(b))
 	if err != nil {
-		return errors.Wrap(err, "new request")
+		return nil, nil, errors.Wrap(err, "new request")
 	}
 	// Set the authorization header to our OIDC bearer token.
 	req.Header.Set("Authorization", "Bearer "+tok)
 	// Set the content-type to reflect we're sending JSON.
 	req.Header.Set("Content-Type", "application/json")
 
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "requesting cert")
+	}
+	req = req.WithContext(admitted)
 	t := time.Now()
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	latency := time.Since(t).Milliseconds()
 	if err != nil {
-		fmt.Println("error requesting cert: ", err)
+		return nil, nil, errors.Wrap(err, "requesting cert")
 	}
+	defer drainBody(resp.Body)
 
 	// Export data to prometheus
 	statusCode := resp.StatusCode
-	labels := prometheus.Labels{
-		endpointLabel:   endpoint,
-		statusCodeLabel: fmt.Sprintf("%d", statusCode),
-		hostLabel:       fulcioURL,
-	}
-	endpointLatenciesSummary.With(labels).Observe(float64(latency))
-	endpointLatenciesHistogram.With(labels).Observe(float64(latency))
-
-	fmt.Println("Observing ", fulcioURL+endpoint)
-	fmt.Println("Status code: ", statusCode)
-	fmt.Println("Latency: ", latency)
-	return nil
+	exportDataToPrometheus(ctx, fulcioURL, label, statusCode, latency)
+	logRequest(fulcioURL, label, statusCode, latency)
+	if statusCode != http.StatusCreated {
+		return nil, nil, errors.Wrap(&statusCodeError{statusCode: statusCode}, "requesting cert")
+	}
+
+	// Make sure the certificate we got back is one we can actually use.
+	chain, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(bodyReadError(err), "reading cert")
+	}
+	recordCertIdentity(fulcioURL, chain)
+	err = verifyFulcioCert(ctx, client, fulcioURL, chain, identity)
+	recordVerificationResult(fulcioURL, label, err)
+	if err != nil {
+		return nil, nil, &verificationError{err: err}
+	}
+	// Check that the certificate was logged to the CT log.
+	err = verifySCT(chain, resp.Header.Get(sctHeader))
+	recordSCTResult(fulcioURL, err)
+	if err != nil {
+		if requireSCT {
+			return nil, nil, &verificationError{err: err}
+		}
+		logger.Warnw("certificate SCT check failed", "host", fulcioURL, "error", err)
+	}
+	return chain, priv, nil
 }
 
-func certificateRequest(ctx context.Context, idToken string) ([]byte, error) {
-	priv, err := cosign.GeneratePrivateKey()
+// rekorWriteEndpoint tests the write path for Rekor by uploading a
+// hashedrekord entry to "/api/v1/log/entries" and then fetching it back
+// by UUID from "/api/v1/log/entries/{entryUUID}".
+func rekorWriteEndpoint(ctx context.Context, client *http.Client, rekorURL string) error {
+	priv, err := signingKey()
 	if err != nil {
-		return nil, errors.Wrap(err, "generating cert")
+		return errors.Wrap(err, "generating key")
 	}
-	pubBytes, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubPEM, err := cryptoutils.MarshalPublicKeyToPEM(&priv.PublicKey)
+	if err != nil {
+		return err
+	}
+	b, err := hashedRekordRequest(priv, pubPEM)
+	if err != nil {
+		return errors.Wrap(err, "hashedrekord request")
+	}
+	uuid, err := uploadEntry(ctx, client, rekorURL, b, rekorWriteEndpointLabel)
+	if err != nil {
+		return err
+	}
+	// Read the entry back to make sure the roundtrip succeeds.
+	_, err = retrieveEntry(ctx, client, rekorURL, uuid, rekorEntriesEndpoint+"/{entryUUID} (write)")
+	return err
+}
+
+// uploadEntry uploads the proposed entry b to "/api/v1/log/entries" and
+// returns the UUID of the new entry. The request is recorded under the
+// endpoint label.
+func uploadEntry(ctx context.Context, client *http.Client, rekorURL string, b []byte, label string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rekorURL+rekorEntriesEndpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return "", errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Debugw("observing", "host", rekorURL, "endpoint", label)
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return "", errors.Wrap(err, "uploading entry")
+	}
+	req = req.WithContext(admitted)
+	t := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(t).Milliseconds()
+	if err != nil {
+		return "", errors.Wrap(err, "uploading entry")
+	}
+	defer drainBody(resp.Body)
+	exportDataToPrometheus(ctx, rekorURL, label, resp.StatusCode, latency)
+	logRequest(rekorURL, label, resp.StatusCode, latency)
+	if resp.StatusCode != http.StatusCreated {
+		return "", errors.Wrap(&statusCodeError{statusCode: resp.StatusCode}, "uploading entry")
+	}
+
+	var entry models.LogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return "", errors.Wrap(err, "decoding uploaded entry")
+	}
+	if len(entry) != 1 {
+		return "", fmt.Errorf("expected one uploaded entry, got %d", len(entry))
+	}
+	var uuid string
+	for k := range entry {
+		uuid = k
+	}
+	return uuid, nil
+}
+
+// retrieveEntry fetches the entry with the given UUID from
+// "/api/v1/log/entries/{entryUUID}" and returns the response body. The
+// request is recorded under the endpoint label.
+func retrieveEntry(ctx context.Context, client *http.Client, rekorURL, uuid, label string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rekorURL+rekorEntriesEndpoint+"/"+uuid, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	logger.Debugw("observing", "host", rekorURL, "endpoint", rekorEntriesEndpoint+"/"+uuid)
+	admitted, err := admitRequest(req.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving entry")
+	}
+	req = req.WithContext(admitted)
+	t := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(t).Milliseconds()
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving entry")
+	}
+	defer drainBody(resp.Body)
+	exportDataToPrometheus(ctx, rekorURL, label, resp.StatusCode, latency)
+	logRequest(rekorURL, label, resp.StatusCode, latency)
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(&statusCodeError{statusCode: resp.StatusCode}, "retrieving entry %s", uuid)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(bodyReadError(err), "reading entry %s", uuid)
+	}
+	return body, nil
+}
+
+// hashedRekordRequest returns a hashedrekord proposed entry over some
+// random data, signed with priv. pubPEM is the PEM public key or
+// certificate to verify the signature with.
+func hashedRekordRequest(priv *ecdsa.PrivateKey, pubPEM []byte) ([]byte, error) {
+	// Use random data so that every upload is a new entry.
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, h[:])
 	if err != nil {
 		return nil, err
 	}
 
+	pe := models.Hashedrekord{
+		APIVersion: swag.String(hashedrekordv001.APIVERSION),
+		Spec: models.HashedrekordV001Schema{
+			Data: &models.HashedrekordV001SchemaData{
+				Hash: &models.HashedrekordV001SchemaDataHash{
+					Algorithm: swag.String(models.HashedrekordV001SchemaDataHashAlgorithmSha256),
+					Value:     swag.String(hex.EncodeToString(h[:])),
+				},
+			},
+			Signature: &models.HashedrekordV001SchemaSignature{
+				Content: strfmt.Base64(sig),
+				PublicKey: &models.HashedrekordV001SchemaSignaturePublicKey{
+					Content: strfmt.Base64(pubPEM),
+				},
+			},
+		},
+	}
+	return json.Marshal(pe)
+}
+
+// certificateRequest returns a certificate request for the signing key,
+// along with the identity from idToken that the certificate will be issued
+// for and the key itself.
+func certificateRequest(ctx context.Context, idToken string) ([]byte, string, *ecdsa.PrivateKey, error) {
+	priv, err := signingKey()
+	if err != nil {
+		return nil, "", nil, errors.Wrap(err, "generating cert")
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	tok, err := oauthflow.OIDConnect(defaultOIDCIssuer, defaultOIDCClientID, "", "", &oauthflow.StaticTokenGetter{RawToken: idToken})
 	if err != nil {
-		return nil, err
+		return nil, "", nil, err
 	}
 
 	// Sign the email address as part of the request
 	h := sha256.Sum256([]byte(tok.Subject))
 	proof, err := ecdsa.SignASN1(rand.Reader, priv, h[:])
 	if err != nil {
-		return nil, err
+		return nil, "", nil, err
 	}
 
 	cr := api.CertificateRequest{
@@ -120,5 +292,6 @@ func certificateRequest(ctx context.Context, idToken string) ([]byte, error) {
 		SignedEmailAddress: proof,
 	}
 
-	return json.Marshal(cr)
+	b, err := json.Marshal(cr)
+	return b, tok.Subject, priv, err
 }
@@ -0,0 +1,78 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidctoken fetches OIDC tokens from the ambient providers, such as
+// GitHub Actions or a Kubernetes service account, that cosign supports.
+package oidctoken
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sigstore/cosign/pkg/providers"
+
+	// Register all the ambient providers.
+	_ "github.com/sigstore/cosign/pkg/providers/all"
+)
+
+// DefaultAudience is the audience Fulcio expects tokens to be issued for.
+const DefaultAudience = "sigstore"
+
+// The ambient provider registry, replaced in tests so that the providers
+// enabled on the machine running them do not matter.
+var (
+	anyEnabled  = providers.Enabled
+	provideAny  = providers.Provide
+	provideFrom = providers.ProvideFrom
+)
+
+// Enabled reports whether the named ambient provider is enabled in this
+// environment. If provider is empty it reports whether any provider is.
+func Enabled(ctx context.Context, provider string) bool {
+	if provider == "" {
+		return anyEnabled(ctx)
+	}
+	p, err := provideFrom(ctx, provider)
+	if err != nil {
+		return false
+	}
+	return p.Enabled(ctx)
+}
+
+// Get returns a token for audience from the named ambient provider. If
+// provider is empty the first enabled provider that returns a token is used.
+func Get(ctx context.Context, provider, audience string) (string, error) {
+	if provider == "" {
+		if !anyEnabled(ctx) {
+			return "", fmt.Errorf("no ambient OIDC provider is enabled")
+		}
+		tok, err := provideAny(ctx, audience)
+		if err != nil {
+			return "", fmt.Errorf("getting token from provider: %w", err)
+		}
+		return tok, nil
+	}
+	p, err := provideFrom(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	if !p.Enabled(ctx) {
+		return "", fmt.Errorf("OIDC provider %s is not enabled", provider)
+	}
+	tok, err := p.Provide(ctx, audience)
+	if err != nil {
+		return "", fmt.Errorf("getting token from provider %s: %w", provider, err)
+	}
+	return tok, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 The Sigstore Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidctoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sigstore/cosign/pkg/providers"
+)
+
+// stubProvider returns a token naming itself and the audience it was asked
+// for, or err if set.
+type stubProvider struct {
+	name    string
+	enabled bool
+	err     error
+}
+
+func (p stubProvider) Enabled(context.Context) bool { return p.enabled }
+
+func (p stubProvider) Provide(_ context.Context, audience string) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.name + ":" + audience, nil
+}
+
+// useProviders replaces the ambient provider registry with ps for the
+// duration of the test. Unlike the real registry, the first enabled
+// provider is the first in ps that returns a token.
+func useProviders(t *testing.T, ps ...stubProvider) {
+	t.Helper()
+	oldEnabled, oldAny, oldFrom := anyEnabled, provideAny, provideFrom
+	t.Cleanup(func() { anyEnabled, provideAny, provideFrom = oldEnabled, oldAny, oldFrom })
+	anyEnabled = func(context.Context) bool {
+		for _, p := range ps {
+			if p.enabled {
+				return true
+			}
+		}
+		return false
+	}
+	provideAny = func(ctx context.Context, audience string) (string, error) {
+		err := errors.New("no providers are enabled")
+		for _, p := range ps {
+			if !p.enabled {
+				continue
+			}
+			var tok string
+			if tok, err = p.Provide(ctx, audience); err == nil {
+				return tok, nil
+			}
+		}
+		return "", err
+	}
+	provideFrom = func(_ context.Context, name string) (providers.Interface, error) {
+		for _, p := range ps {
+			if p.name == name {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not a valid provider", name)
+	}
+}
+
+func TestGet(t *testing.T) {
+	errBroken := errors.New("broken")
+	tests := []struct {
+		name      string
+		providers []stubProvider
+		provider  string
+		audience  string
+		want      string
+		wantErr   string
+	}{{
+		name:      "first enabled provider",
+		providers: []stubProvider{{name: "github-actions"}, {name: "spiffe", enabled: true}, {name: "filesystem", enabled: true}},
+		audience:  DefaultAudience,
+		want:      "spiffe:sigstore",
+	}, {
+		name:      "skips a failing provider",
+		providers: []stubProvider{{name: "github-actions", enabled: true, err: errBroken}, {name: "spiffe", enabled: true}},
+		audience:  DefaultAudience,
+		want:      "spiffe:sigstore",
+	}, {
+		name:      "custom audience",
+		providers: []stubProvider{{name: "spiffe", enabled: true}},
+		audience:  "example.com",
+		want:      "spiffe:example.com",
+	}, {
+		name:      "named provider",
+		providers: []stubProvider{{name: "spiffe", enabled: true}, {name: "filesystem", enabled: true}},
+		provider:  "filesystem",
+		audience:  DefaultAudience,
+		want:      "filesystem:sigstore",
+	}, {
+		name:      "no provider enabled",
+		providers: []stubProvider{{name: "github-actions"}},
+		audience:  DefaultAudience,
+		wantErr:   "no ambient OIDC provider is enabled",
+	}, {
+		name:      "every provider fails",
+		providers: []stubProvider{{name: "github-actions", enabled: true, err: errBroken}},
+		audience:  DefaultAudience,
+		wantErr:   "getting token from provider: broken",
+	}, {
+		name:      "unknown named provider",
+		providers: []stubProvider{{name: "spiffe", enabled: true}},
+		provider:  "github-actions",
+		audience:  DefaultAudience,
+		wantErr:   "github-actions is not a valid provider",
+	}, {
+		name:      "named provider disabled",
+		providers: []stubProvider{{name: "spiffe", enabled: true}, {name: "github-actions"}},
+		provider:  "github-actions",
+		audience:  DefaultAudience,
+		wantErr:   "OIDC provider github-actions is not enabled",
+	}, {
+		name:      "named provider fails",
+		providers: []stubProvider{{name: "spiffe", enabled: true}, {name: "github-actions", enabled: true, err: errBroken}},
+		provider:  "github-actions",
+		audience:  DefaultAudience,
+		wantErr:   "getting token from provider github-actions: broken",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useProviders(t, tt.providers...)
+			got, err := Get(context.Background(), tt.provider, tt.audience)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Get() = %q, %v, want error containing %q", got, err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("Get() = %v, want %q", err, tt.want)
+			case got != tt.want:
+				t.Errorf("Get() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []stubProvider
+		provider  string
+		want      bool
+	}{
+		{"any provider enabled", []stubProvider{{name: "github-actions"}, {name: "spiffe", enabled: true}}, "", true},
+		{"no provider enabled", []stubProvider{{name: "github-actions"}}, "", false},
+		{"named provider enabled", []stubProvider{{name: "spiffe", enabled: true}}, "spiffe", true},
+		{"named provider disabled", []stubProvider{{name: "spiffe", enabled: true}, {name: "github-actions"}}, "github-actions", false},
+		{"unknown named provider", []stubProvider{{name: "spiffe", enabled: true}}, "github-actions", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useProviders(t, tt.providers...)
+			if got := Enabled(context.Background(), tt.provider); got != tt.want {
+				t.Errorf("Enabled(%q) = %v, want %v", tt.provider, got, tt.want)
+			}
+		})
+	}
+}